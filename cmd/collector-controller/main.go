@@ -1,19 +1,52 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/baizeai/kcover/pkg/config"
 	"github.com/baizeai/kcover/pkg/diagnosis"
 	"github.com/baizeai/kcover/pkg/diagnosis/nvidiadiag"
+	// the diagnostics of the agent register themselves
+	_ "github.com/baizeai/kcover/pkg/diagnosis/clock"
+	_ "github.com/baizeai/kcover/pkg/diagnosis/edac"
+	_ "github.com/baizeai/kcover/pkg/diagnosis/execplugin"
+	_ "github.com/baizeai/kcover/pkg/diagnosis/infiniband"
+	_ "github.com/baizeai/kcover/pkg/diagnosis/pcie"
+	_ "github.com/baizeai/kcover/pkg/diagnosis/storage"
 	"github.com/baizeai/kcover/pkg/events"
 	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/baizeai/kcover/pkg/nodehealth"
+	"github.com/baizeai/kcover/pkg/stream"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
 func main() {
+	conf := config.NewAgentConfiguration()
+	conf.AddFlags(flag.CommandLine)
+	var exporterRulesFile string
+	flag.StringVar(&exporterRulesFile, "dcgm-exporter-rules", "", "json file of the threshold rules of dcgm-exporter metrics, overrides the rules of the config file")
+	klog.InitFlags(nil)
+	loader, err := config.Parse(flag.CommandLine, os.Args[1:], conf)
+	if err != nil {
+		klog.Fatalf("invalid configuration: %v", err)
+	}
+	queueOpts := conf.EventQueue.Options()
+
+	if conf.MetricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			klog.Fatal(http.ListenAndServe(conf.MetricsAddr, mux))
+		}()
+	}
+
 	var hostName string
 	if hn := os.Getenv("FAST_RECOVERY_NODE_NAME"); hn != "" {
 		hostName = hn
@@ -25,30 +58,53 @@ func main() {
 		hostName = hn
 	}
 
-	dcgmDiag, err := nvidiadiag.NewDCGMDiagnosis(hostName)
-	if err != nil {
-		panic(err)
+	var exporterRules []nvidiadiag.ThresholdRule
+	if exporterRulesFile != "" {
+		bs, err := os.ReadFile(exporterRulesFile)
+		if err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(bs, &exporterRules); err != nil {
+			panic(err)
+		}
+		setExporterRules(conf, exporterRules)
 	}
 
-	diags := []diagnosis.Diagnostic{dcgmDiag}
 	cfg := kube.GetK8sConfigConfigWithFile("", "")
 	client := kubernetes.NewForConfigOrDie(cfg)
-	recorder := events.NewKubeEventsRecorder(client, false)
 
-	for _, d := range diags {
-		if err := d.Start(); err != nil {
+	recorder := events.NewKubeEventsRecorder(client, false, conf.EventsAPI, events.DefaultWatchOptions, queueOpts)
+	if conf.Stream.ControllerAddr != "" {
+		var err error
+		recorder, err = stream.NewStreamRecorder(hostName, conf.Stream.Options(), recorder)
+		if err != nil {
 			panic(err)
 		}
+	}
+	if conf.NodeCondition.Enabled {
+		recorder = nodehealth.NewConditionRecorder(client, hostName, nodeConditionOptions(conf), recorder)
+	}
+	if err := recorder.Start(); err != nil {
+		panic(err)
+	}
 
-		klog.Infof("diag %T started", d)
-
-		go func(d diagnosis.Diagnostic) {
-			for e := range d.Events() {
-				if err := recorder.RecordEvent(e); err != nil {
-					klog.Errorf("record event %+v error: %v", e, err)
-				}
-			}
-		}(d)
+	diags := newDiagnostics(conf, diagnosis.Context{
+		NodeName:   hostName,
+		Client:     client,
+		RestConfig: cfg,
+		Queue:      queueOpts,
+	}, recorder)
+	diags.exporterRules = exporterRules
+	if err := diags.apply(conf); err != nil {
+		klog.Fatalf("start diagnostics error: %v", err)
+	}
+	if loader.Path != "" && conf.ReloadInterval.Duration > 0 {
+		watcher := config.NewWatcher(loader, conf.ReloadInterval.Duration, func() config.Object {
+			return config.NewAgentConfiguration()
+		}, diags.onChange, diags.onError)
+		if err := watcher.Start(); err != nil {
+			klog.Fatalf("watch config error: %v", err)
+		}
 	}
 
 	cc := make(chan os.Signal, 1)
@@ -56,3 +112,21 @@ func main() {
 	<-cc
 	klog.Info("collector stopped")
 }
+
+// setExporterRules overrides the rules of the dcgm-exporter section of the configuration.
+func setExporterRules(conf *config.AgentConfiguration, rules []nvidiadiag.ThresholdRule) {
+	if e, ok := conf.Diagnostics[nvidiadiag.ExporterName].(*nvidiadiag.ExporterConfig); ok {
+		e.Rules = rules
+	}
+}
+
+// nodeConditionOptions adds the reasons of the dcgm-exporter rules to the GPU faults of the condition.
+func nodeConditionOptions(conf *config.AgentConfiguration) nodehealth.Options {
+	opts := conf.NodeCondition.Options()
+	if e, ok := conf.Diagnostics[nvidiadiag.ExporterName].(*nvidiadiag.ExporterConfig); ok {
+		for _, rule := range e.Rules {
+			opts.GPUReasons = append(opts.GPUReasons, rule.Reason)
+		}
+	}
+	return opts
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/diagnosis/nvidiadiag"
+	"github.com/baizeai/kcover/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+type runningDiagnostic struct {
+	// ctx the diagnostic was created with
+	ctx  diagnosis.Context
+	diag diagnosis.Diagnostic
+}
+
+// diagnostics runs the diagnostics enabled on the node. A reloaded configuration restarts the
+// diagnostics whose options changed and starts or stops the ones enabled or disabled, the others
+// keep running with their state.
+type diagnostics struct {
+	mu   sync.Mutex
+	conf *config.AgentConfiguration
+	// exporterRules of --dcgm-exporter-rules override the ones of the file
+	exporterRules []nvidiadiag.ThresholdRule
+	// ctx creates the diagnostics, the options and the fields of the configuration are set for
+	// each one
+	ctx        diagnosis.Context
+	recorder   events.Recorder
+	nodeLabels map[string]string
+	running    map[string]runningDiagnostic
+	// names of the running diagnostics in the order they started
+	names []string
+}
+
+func newDiagnostics(conf *config.AgentConfiguration, ctx diagnosis.Context, recorder events.Recorder) *diagnostics {
+	return &diagnostics{
+		conf:     conf,
+		ctx:      ctx,
+		recorder: recorder,
+		running:  map[string]runningDiagnostic{},
+	}
+}
+
+// labels of the node, they are only read if the configuration has node pools.
+func (d *diagnostics) labels(conf *config.AgentConfiguration) (map[string]string, error) {
+	if len(conf.NodePools) == 0 || d.nodeLabels != nil {
+		return d.nodeLabels, nil
+	}
+	node, err := d.ctx.Client.CoreV1().Nodes().Get(context.Background(), d.ctx.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	d.nodeLabels = node.Labels
+	return d.nodeLabels, nil
+}
+
+// apply runs the diagnostics of the configuration, it returns the first error after applying all
+// the others.
+func (d *diagnostics) apply(conf *config.AgentConfiguration) error {
+	nodeLabels, err := d.labels(conf)
+	if err != nil {
+		return err
+	}
+	names, err := conf.EnabledDiagnostics(nodeLabels)
+	if err != nil {
+		return err
+	}
+	wanted := map[string]diagnosis.Context{}
+	for _, name := range names {
+		ctx := d.ctx
+		ctx.SysfsRoot = conf.SysfsRoot
+		ctx.RepeatInterval = conf.RepeatInterval.Duration
+		ctx.Options = conf.Diagnostics[name]
+		wanted[name] = ctx
+	}
+
+	var kept []string
+	for _, name := range d.names {
+		r := d.running[name]
+		if ctx, ok := wanted[name]; ok && reflect.DeepEqual(ctx, r.ctx) {
+			kept = append(kept, name)
+			continue
+		}
+		r.diag.Stop()
+		delete(d.running, name)
+		klog.Infof("diagnostic %s stopped", name)
+	}
+	d.names = kept
+	var firstErr error
+	for _, name := range names {
+		if _, running := d.running[name]; running {
+			continue
+		}
+		if err := d.start(name, wanted[name]); err != nil {
+			klog.Errorf("start diagnostic %s error: %v", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	klog.Infof("diagnostics %v enabled", d.names)
+	return firstErr
+}
+
+func (d *diagnostics) start(name string, ctx diagnosis.Context) error {
+	diag, err := diagnosis.New(name, ctx)
+	if err != nil {
+		return err
+	}
+	if err := diag.Start(); err != nil {
+		return err
+	}
+	d.running[name] = runningDiagnostic{ctx: ctx, diag: diag}
+	d.names = append(d.names, name)
+	klog.Infof("diagnostic %s started", name)
+	go func() {
+		// the events end when the diagnostic is stopped
+		for e := range diag.Events() {
+			if err := d.recorder.RecordEvent(e); err != nil {
+				klog.Errorf("record event %+v error: %v", e, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *diagnostics) onChange(obj config.Object) {
+	conf := obj.(*config.AgentConfiguration)
+	if d.exporterRules != nil {
+		setExporterRules(conf, d.exporterRules)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// keep the running values of the fields which are not reloadable, they are not applied
+	// until a restart
+	unchanged := *d.conf
+	unchanged.CopyReloadable(conf)
+	if err := d.apply(&unchanged); err != nil {
+		klog.Errorf("apply the reloaded config error: %v", err)
+	}
+	d.conf = &unchanged
+	if reflect.DeepEqual(&unchanged, conf) {
+		klog.Info("config reloaded")
+		return
+	}
+	klog.Warning("config reloaded, the changes other than the diagnostics, node pools, sysfs root and repeat interval take effect after a restart")
+}
+
+func (d *diagnostics) onError(err error) {
+	klog.Errorf("invalid config, keep the old one: %v", err)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// setLeaderLabel labels the controller pod as the leader or removes the label, the service only
+// selects the leader so that the agents and alertmanager reach the replica with the sinks.
+func setLeaderLabel(cli kubernetes.Interface, namespace, name string, leader bool) {
+	var value *string
+	if leader {
+		value = lo.ToPtr(constants.True)
+	}
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.2, Steps: 6, Cap: 30 * time.Second}
+	err := retry.OnError(backoff, func(error) bool { return true }, func() error {
+		return kube.PatchPodLabels(context.Background(), cli, namespace, name, map[string]*string{constants.LeaderLabel: value})
+	})
+	if err != nil {
+		klog.Errorf("set the leader label of pod %s/%s to %v error: %v", namespace, name, leader, err)
+	}
+}
@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
 	"os"
-	"time"
 
+	"github.com/baizeai/kcover/pkg/alertmanager"
+	"github.com/baizeai/kcover/pkg/config"
 	"github.com/baizeai/kcover/pkg/diagnosis/controller"
+	"github.com/baizeai/kcover/pkg/diagnosis/ncclprobe"
 	"github.com/baizeai/kcover/pkg/events"
 	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/baizeai/kcover/pkg/metrics"
 	"github.com/baizeai/kcover/pkg/recovery"
-	"github.com/baizeai/kcover/pkg/runner"
+	"github.com/baizeai/kcover/pkg/stream"
+	"github.com/baizeai/kcover/pkg/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
@@ -19,61 +26,181 @@ import (
 )
 
 func main() {
-	hostName, err := os.Hostname()
+	conf := config.NewControllerConfiguration()
+	conf.AddFlags(flag.CommandLine)
+	var alertmanagerOptionsFile string
+	flag.StringVar(&alertmanagerOptionsFile, "alertmanager-options", "", "json file of the label mapping options of alertmanager alerts, overrides the options of the config file")
+	klog.InitFlags(nil)
+	loader, err := config.Parse(flag.CommandLine, os.Args[1:], conf)
 	if err != nil {
-		panic(err)
+		klog.Fatalf("invalid configuration: %v", err)
+	}
+	podNamespace := "default"
+	if bs, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		podNamespace = string(bs)
+	}
+	queueOpts := conf.EventQueue.Options()
+	watchOpts := conf.Watch.Options()
+	diagOpts := controller.Options{Queue: queueOpts, Watch: watchOpts, Diagnostics: conf.DiagnosticOptions()}
+	if probeOpts, ok := diagOpts.Diagnostics[ncclprobe.Name].(ncclprobe.Options); ok && probeOpts.Namespace == "" {
+		probeOpts.Namespace = podNamespace
+		diagOpts.Diagnostics[ncclprobe.Name] = probeOpts
+	}
+	validationOpts := conf.Validation.Options()
+	if validationOpts.Namespace == "" {
+		validationOpts.Namespace = podNamespace
+	}
+
+	if conf.MetricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			klog.Fatal(http.ListenAndServe(conf.MetricsAddr, mux))
+		}()
 	}
 
+	reload := &reloader{conf: conf}
+	if alertmanagerOptionsFile != "" {
+		bs, err := os.ReadFile(alertmanagerOptionsFile)
+		if err != nil {
+			klog.Fatalf("read alertmanager options error: %v", err)
+		}
+		alertOpts := alertmanager.DefaultOptions
+		if err := json.Unmarshal(bs, &alertOpts); err != nil {
+			klog.Fatalf("parse alertmanager options error: %v", err)
+		}
+		reload.alertOptions = &alertOpts
+	}
+	alertAuth, err := conf.Diagnostics.Alertmanager.Auth()
+	if err != nil {
+		klog.Fatalf("read alertmanager credentials error: %v", err)
+	}
+	if conf.Diagnostics.Alertmanager.Enabled && alertAuth == (alertmanager.Auth{}) {
+		klog.Warning("no credentials of alertmanager are configured, all the notifications will be rejected")
+	}
+	alertReceiver := alertmanager.NewReceiver(reload.alertmanagerOptions(conf), alertAuth)
+	reload.alerts = alertReceiver
+
 	cfg := kube.GetK8sConfigConfigWithFile("", "")
 	client := kubernetes.NewForConfigOrDie(cfg)
+	streamServer := stream.NewServer(client, conf.Stream.Options(watchOpts.MaxEventAge))
+	if err := streamServer.Start(); err != nil {
+		klog.Fatalf("start stream server error: %v", err)
+	}
+	defer streamServer.Stop()
+	recoveryDebug := recovery.NewDebugHandler()
+	if conf.HTTPAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle(stream.Path, streamServer)
+			mux.Handle(recovery.DebugPath, recoveryDebug)
+			if conf.Diagnostics.Alertmanager.Enabled {
+				mux.Handle(alertmanager.Path, alertReceiver)
+			}
+			klog.Fatal(http.ListenAndServe(conf.HTTPAddr, mux))
+		}()
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	// the label survives a restart of the container which has lost the leadership
+	setLeaderLabel(client, podNamespace, hostName, false)
+
 	var eventBus events.Recorder
-	var rec runner.Runner
-	var diag runner.Runner
+	var aggregator *events.Aggregator
+	var streamQueue *events.Queue[events.CollectorEvent]
+	var alertQueue *events.Queue[events.CollectorEvent]
+	var rec *recovery.RecoveryController
+	var diag controller.Diagnostic
+	var val *validation.Controller
+	le := conf.LeaderElection
+	leaseNamespace := le.LeaseNamespace
+	if leaseNamespace == "" {
+		leaseNamespace = podNamespace
+	}
+
+	if loader.Path != "" && conf.ReloadInterval.Duration > 0 {
+		reload.recorder, reload.ref = podEventRecorder(client, podNamespace, hostName)
+		watcher := config.NewWatcher(loader, conf.ReloadInterval.Duration, func() config.Object {
+			return config.NewControllerConfiguration()
+		}, reload.onChange, reload.onError)
+		if err := watcher.Start(); err != nil {
+			klog.Fatalf("watch config error: %v", err)
+		}
+	}
 	leaderElectionConfig := leaderelection.LeaderElectionConfig{
 		Lock: &resourcelock.LeaseLock{
 			Client: coordinationv1client.NewForConfigOrDie(kube.GetK8sConfigConfigWithFile("", "")),
 			LeaseMeta: metav1.ObjectMeta{
-				Name: "kcover",
-				Namespace: func() string {
-					if bs, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
-						return string(bs)
-					}
-					return "default"
-				}(),
+				Name:      le.LeaseName,
+				Namespace: leaseNamespace,
 			},
 			LockConfig: resourcelock.ResourceLockConfig{
 				Identity: hostName,
 			},
 		},
 		ReleaseOnCancel: true,
-		LeaseDuration:   15 * time.Second,
-		RenewDeadline:   10 * time.Second,
-		RetryPeriod:     2 * time.Second,
+		LeaseDuration:   le.LeaseDuration.Duration,
+		RenewDeadline:   le.RenewDeadline.Duration,
+		RetryPeriod:     le.RetryPeriod.Duration,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				// 当当前实例成为 leader 时，开始执行 controller 逻辑
 				var err error
-				eventBus = events.NewKubeEventsRecorder(client, true)
-				rec = recovery.NewRecoveryController(client, eventBus)
-				diag, err = controller.NewControllerDiagnostic(client, eventBus)
+				eventBus = events.NewKubeEventsRecorder(client, true, conf.EventsAPI, watchOpts, queueOpts)
+				streamQueue = events.NewQueue[events.CollectorEvent]("stream", queueOpts)
+				alertQueue = events.NewQueue[events.CollectorEvent]("alertmanager", queueOpts)
+				aggregator = events.NewAggregator(client, conf.AggregationWindow.Duration, watchOpts.Resync, queueOpts, eventBus.EventChan(), streamQueue.C(), alertQueue.C())
+				rec = recovery.NewRecoveryController(client, aggregator.Incidents(), conf.Recovery.Options())
+				diag, err = controller.NewControllerDiagnostic(client, eventBus, diagOpts)
 				if err != nil {
 					panic(err)
 				}
+				reload.setRunning(aggregator, rec, diag)
+				if err := aggregator.Start(); err != nil {
+					panic(err)
+				}
 				if err := rec.Start(); err != nil {
 					panic(err)
 				}
 				if err := diag.Start(); err != nil {
 					panic(err)
 				}
+				if conf.Validation.Enabled {
+					val, err = validation.NewValidationController(client, validationOpts, watchOpts.Resync)
+					if err != nil {
+						panic(err)
+					}
+					if err := val.Start(); err != nil {
+						panic(err)
+					}
+				}
 				if err := eventBus.Start(); err != nil {
 					panic(err)
 				}
+				streamServer.SetSink(streamQueue)
+				alertReceiver.SetSink(alertQueue)
+				recoveryDebug.SetController(rec)
+				setLeaderLabel(client, podNamespace, hostName, true)
 
 				klog.Info("kcover started")
 			},
 			OnStoppedLeading: func() {
+				setLeaderLabel(client, podNamespace, hostName, false)
+				reload.setRunning(nil, nil, nil)
+				streamServer.SetSink(nil)
+				alertReceiver.SetSink(nil)
+				recoveryDebug.SetController(nil)
+				streamQueue.Close()
+				alertQueue.Close()
 				rec.Stop()
+				aggregator.Stop()
 				diag.Stop()
+				if val != nil {
+					val.Stop()
+				}
 				eventBus.Stop()
 				klog.Info("kcover stopped")
 			},
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/baizeai/kcover/pkg/alertmanager"
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis/controller"
+	"github.com/baizeai/kcover/pkg/diagnosis/npd"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/recovery"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// reloader applies the reloaded configuration to the running components at once, so they never
+// see a mix of the old and new settings.
+type reloader struct {
+	mu   sync.Mutex
+	conf *config.ControllerConfiguration
+	// alertOptions of --alertmanager-options override the ones of the file
+	alertOptions *alertmanager.Options
+
+	recorder record.EventRecorder
+	ref      *corev1.ObjectReference
+
+	alerts     *alertmanager.Receiver
+	aggregator *events.Aggregator
+	recovery   *recovery.RecoveryController
+	diag       controller.Diagnostic
+}
+
+func (r *reloader) current() *config.ControllerConfiguration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conf
+}
+
+func (r *reloader) alertmanagerOptions(conf *config.ControllerConfiguration) alertmanager.Options {
+	if r.alertOptions != nil {
+		return *r.alertOptions
+	}
+	return *conf.Diagnostics.Alertmanager.Options
+}
+
+// setRunning sets the components of the leader, nil when it stops leading. The current
+// configuration is applied in case it was reloaded while they were created.
+func (r *reloader) setRunning(aggregator *events.Aggregator, rec *recovery.RecoveryController, diag controller.Diagnostic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aggregator, r.recovery, r.diag = aggregator, rec, diag
+	r.apply()
+}
+
+func (r *reloader) apply() {
+	conf := r.conf
+	r.alerts.SetOptions(r.alertmanagerOptions(conf))
+	if r.aggregator != nil {
+		r.aggregator.SetWindow(conf.AggregationWindow.Duration)
+	}
+	if r.recovery != nil {
+		r.recovery.SetOptions(conf.Recovery.Options())
+	}
+	if r.diag != nil {
+		r.diag.SetNPDOptions(npd.Options{Conditions: conf.Diagnostics.NPD.Conditions, Events: conf.Diagnostics.NPD.Events})
+	}
+}
+
+func (r *reloader) onChange(obj config.Object) {
+	conf := obj.(*config.ControllerConfiguration)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// keep the running values of the fields which are not reloadable, they are not applied
+	// until a restart
+	unchanged := *r.conf
+	unchanged.CopyReloadable(conf)
+	r.conf = &unchanged
+	r.apply()
+	if reflect.DeepEqual(&unchanged, conf) {
+		klog.Info("config reloaded")
+		r.recorder.Event(r.ref, corev1.EventTypeNormal, "ConfigReloaded", "applied the changed config")
+		return
+	}
+	klog.Warning("config reloaded, some of the changes take effect after a restart")
+	r.recorder.Event(r.ref, corev1.EventTypeNormal, "ConfigReloaded",
+		"applied the changed config, the changes other than the aggregation window, recovery options, npd rules and alertmanager options take effect after a restart")
+}
+
+func (r *reloader) onError(err error) {
+	klog.Errorf("invalid config, keep the old one: %v", err)
+	r.recorder.Eventf(r.ref, corev1.EventTypeWarning, "InvalidConfig", "keep the old config: %v", err)
+}
+
+// podEventRecorder records the events of the config to the pod of the controller.
+func podEventRecorder(cli kubernetes.Interface, namespace, name string) (record.EventRecorder, *corev1.ObjectReference) {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: cli.CoreV1().Events(""),
+	})
+	recorder := eventBroadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "kcover"})
+	ref := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name}
+	pod, err := cli.CoreV1().Pods(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("get pod %s/%s error, the config events have no uid: %v", namespace, name, err)
+		return recorder, ref
+	}
+	ref.UID = pod.UID
+	return recorder, ref
+}
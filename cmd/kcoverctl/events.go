@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/events"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func objectName(ref corev1.ObjectReference) string {
+	if ref.Namespace == "" {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// listEvents lists the events since the time which have the annotation, sorted by time.
+func listEvents(cli kubernetes.Interface, namespace string, opts metav1.ListOptions, annotation string, since time.Time) ([]corev1.Event, error) {
+	list, err := cli.CoreV1().Events(namespace).List(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	var res []corev1.Event
+	for _, e := range list.Items {
+		if _, ok := e.Annotations[annotation]; !ok || events.ObservedTime(&e).Before(since) {
+			continue
+		}
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return events.ObservedTime(&res[i]).Before(events.ObservedTime(&res[j]))
+	})
+	return res, nil
+}
+
+func parseListFlags(name string, args []string) (string, time.Time, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var namespace string
+	var since time.Duration
+	fs.StringVar(&namespace, "n", "", "namespace of the events, all namespaces if empty")
+	fs.DurationVar(&since, "since", time.Hour, "only list the events in this duration")
+	if err := fs.Parse(args); err != nil {
+		return "", time.Time{}, err
+	}
+	return namespace, time.Now().Add(-since), nil
+}
+
+func oneLine(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func runEvents(cli kubernetes.Interface, args []string) error {
+	namespace, since, err := parseListFlags("events", args)
+	if err != nil {
+		return err
+	}
+	list, err := listEvents(cli, namespace, metav1.ListOptions{}, constants.NeedRecoveryAnnotation, since)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tOBJECT\tDEVICE\tREASON\tCOUNT\tMESSAGE")
+	for _, e := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", events.ObservedTime(&e).Format(time.RFC3339),
+			e.Annotations[constants.EventTypeAnnotation], objectName(e.InvolvedObject),
+			e.Annotations[constants.DeviceAnnotation], e.Reason, events.ObservedCount(&e), oneLine(e.Message))
+	}
+	return w.Flush()
+}
+
+func runActions(cli kubernetes.Interface, args []string) error {
+	namespace, since, err := parseListFlags("actions", args)
+	if err != nil {
+		return err
+	}
+	list, err := listEvents(cli, namespace, metav1.ListOptions{}, constants.ActionAnnotation, since)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tOBJECT\tCOUNT\tMESSAGE")
+	for _, e := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", events.ObservedTime(&e).Format(time.RFC3339),
+			e.Annotations[constants.ActionAnnotation], objectName(e.InvolvedObject), events.ObservedCount(&e), oneLine(e.Message))
+	}
+	return w.Flush()
+}
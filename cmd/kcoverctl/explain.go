@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/recovery"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// runExplain checks the job like the recovery controller does before restarting it.
+func runExplain(cli kubernetes.Interface, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	var cooldown time.Duration
+	fs.DurationVar(&cooldown, "restart-cooldown", recovery.DefaultRestartCooldown, "restart cooldown of the controller, see its --restart-cooldown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect one <namespace>/<job> argument")
+	}
+	namespace, job, ok := strings.Cut(fs.Arg(0), "/")
+	if !ok || namespace == "" || job == "" {
+		return fmt.Errorf("invalid job %q, expect <namespace>/<job>", fs.Arg(0))
+	}
+	ctx := context.Background()
+	pods, err := cli.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", constants.KubeflowJobLabel, job),
+	})
+	if err != nil {
+		return fmt.Errorf("list pods of job error: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "Job:\t%s/%s\n", namespace, job)
+	if len(pods.Items) == 0 {
+		fmt.Fprintf(w, "Decision:\tnot restarted, the job has no pods with the %s label\n", constants.KubeflowJobLabel)
+		return nil
+	}
+	nodes := sets.New[string]()
+	podNames := sets.New[string]()
+	for _, pod := range pods.Items {
+		podNames.Insert(pod.Name)
+		if pod.Spec.NodeName != "" {
+			nodes.Insert(pod.Spec.NodeName)
+		}
+	}
+	fmt.Fprintf(w, "Pods:\t%d on nodes %s\n", len(pods.Items), strings.Join(sets.List(nodes), ","))
+
+	// any pod of the job may be the one reported, the controller checks the reported one
+	pod := &pods.Items[0]
+	var reasons []string
+	switch {
+	case pod.Labels[constants.EnabledRecoveryLabel] == constants.True:
+		fmt.Fprintf(w, "Recovery label:\tenabled on pod %s\n", pod.Name)
+	default:
+		ls, err := recovery.JobLabels(cli, pod)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "Recovery label:\tunknown, get the labels of the owner job error: %v\n", err)
+			reasons = append(reasons, "the labels of the owner job can not be read")
+		case ls[constants.EnabledRecoveryLabel] == constants.True:
+			fmt.Fprintf(w, "Recovery label:\tenabled on the owner job\n")
+		default:
+			fmt.Fprintf(w, "Recovery label:\tmissing, label the job with %s=true\n", constants.EnabledRecoveryLabel)
+			reasons = append(reasons, "recovery is not enabled")
+		}
+	}
+	fmt.Fprintf(w, "Restart policy:\t%s\n", pod.Spec.RestartPolicy)
+	if pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
+		reasons = append(reasons, "the pods have RestartPolicyNever")
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	actions, err := listEvents(cli, namespace, metav1.ListOptions{}, constants.ActionAnnotation, since)
+	if err != nil {
+		return fmt.Errorf("list recovery actions error: %w", err)
+	}
+	var restarts []corev1.Event
+	for _, e := range actions {
+		if e.Annotations[constants.ActionAnnotation] == recovery.ActionRestartJob &&
+			(e.InvolvedObject.Name == job || podNames.Has(e.InvolvedObject.Name)) {
+			restarts = append(restarts, e)
+		}
+	}
+	if len(restarts) == 0 {
+		fmt.Fprintf(w, "Last restart:\tnone in the last 24h\n")
+	} else {
+		last := events.ObservedTime(&restarts[len(restarts)-1])
+		ago := time.Since(last).Round(time.Second)
+		if remaining := cooldown - time.Since(last); remaining > 0 {
+			fmt.Fprintf(w, "Last restart:\t%s (%v ago), in cooldown for %v\n", last.Format(time.RFC3339), ago, remaining.Round(time.Second))
+			reasons = append(reasons, "the job was restarted in the cooldown")
+		} else {
+			fmt.Fprintf(w, "Last restart:\t%s (%v ago)\n", last.Format(time.RFC3339), ago)
+		}
+		count := int32(0)
+		for _, e := range restarts {
+			count += events.ObservedCount(&e)
+		}
+		fmt.Fprintf(w, "Restarts:\t%d in the last 24h\n", count)
+	}
+	fmt.Fprintf(w, "Restart budget:\tunlimited, only the %v cooldown applies\n", cooldown)
+
+	skips, err := listEvents(cli, namespace, metav1.ListOptions{}, constants.DecisionAnnotation, since)
+	if err != nil {
+		return fmt.Errorf("list recovery decisions error: %w", err)
+	}
+	for i := len(skips) - 1; i >= 0; i-- {
+		if e := skips[i]; e.InvolvedObject.Name == job || podNames.Has(e.InvolvedObject.Name) {
+			fmt.Fprintf(w, "Last decision:\t%s %s: %s\n", events.ObservedTime(&e).Format(time.RFC3339), e.Reason, oneLine(e.Message))
+			break
+		}
+	}
+
+	faults, err := listEvents(cli, namespace, metav1.ListOptions{}, constants.NeedRecoveryAnnotation, time.Now().Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("list fault events error: %w", err)
+	}
+	var jobFaults []corev1.Event
+	for _, e := range faults {
+		if podNames.Has(e.InvolvedObject.Name) {
+			jobFaults = append(jobFaults, e)
+		}
+	}
+	sort.Slice(jobFaults, func(i, j int) bool {
+		return events.ObservedTime(&jobFaults[i]).After(events.ObservedTime(&jobFaults[j]))
+	})
+	fmt.Fprintf(w, "Faults in 1h:\t%d\n", len(jobFaults))
+	for _, e := range jobFaults {
+		fmt.Fprintf(w, "  %s\t%s %s %s: %s\n", events.ObservedTime(&e).Format(time.RFC3339),
+			e.InvolvedObject.Name, e.Annotations[constants.EventTypeAnnotation], e.Reason, oneLine(e.Message))
+	}
+
+	fmt.Fprintf(w, "Trace:\tcurl http://<controller>:8090%s?job=%s/%s\n", recovery.DebugPath, namespace, job)
+	if len(reasons) == 0 {
+		fmt.Fprintf(w, "Decision:\ta fault event of an error type would restart the job\n")
+	} else {
+		fmt.Fprintf(w, "Decision:\tnot restarted, %s\n", strings.Join(reasons, ", "))
+	}
+	return nil
+}
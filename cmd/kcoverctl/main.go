@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/baizeai/kcover/pkg/kube"
+	"k8s.io/client-go/kubernetes"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(cli kubernetes.Interface, args []string) error
+}
+
+var commands = []command{
+	{"events", "[-n namespace] [--since 1h]\n\tlist recent fault events", runEvents},
+	{"actions", "[-n namespace] [--since 1h]\n\tlist recent recovery actions", runActions},
+	{"explain", "[--restart-cooldown 30s] <namespace>/<job>\n\tshow why the job was or was not restarted", runExplain},
+	{"trigger", "[--type Error|Warning] [--reason Error] [--message msg] [--device id] pod <namespace>/<name> | node <name>\n\trecord a fault event of the pod or node", runTrigger},
+	{"history", "[node...]\n\tlist the nodes with faults, or the faults of the nodes", runHistory},
+	{"unquarantine", "<node...>\n\tclear the quarantine of the nodes with too many faults, they stay cordoned", runUnquarantine},
+	{"repaired", "<node...>\n\tmark the nodes cordoned by kcover repaired, they are uncordoned once validated", runRepaired},
+	{"uncordon", "[--all] [--force] [--dry-run] [node...]\n\tuncordon the nodes cordoned by kcover", runUncordon},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: kcoverctl [--kubeconfig file] [--context name] <command> [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var kubeconfig, kubeContext string
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file, KUBECONFIG or ~/.kube/config is used if empty")
+	flag.StringVar(&kubeContext, "context", "", "name of the kubeconfig context to use")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		cfg := kube.GetK8sConfigConfigWithFile(kubeconfig, kubeContext)
+		if cfg == nil {
+			fmt.Fprintln(os.Stderr, "no kubeconfig found")
+			os.Exit(1)
+		}
+		cli, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create kubernetes client error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := c.run(cli, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
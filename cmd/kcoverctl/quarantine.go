@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/baizeai/kcover/pkg/recovery"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// runHistory lists the nodes with faults, or the faults of the given nodes.
+func runHistory(cli kubernetes.Interface, args []string) error {
+	ctx := context.Background()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	if len(args) > 0 {
+		fmt.Fprintln(w, "NODE\tTIME\tREASON")
+		for _, name := range args {
+			n, err := cli.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			h, err := recovery.NodeFaultHistory(n)
+			if err != nil {
+				return err
+			}
+			for _, f := range h.Faults {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", name, f.Time.Format(time.RFC3339), oneLine(f.Reason))
+			}
+			if h.ClearedAt != nil {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", name, h.ClearedAt.Format(time.RFC3339), "quarantine cleared")
+			}
+		}
+		return nil
+	}
+
+	list, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "NODE\tFAULTS\tLAST FAULT\tREASON\tQUARANTINED")
+	for _, n := range list.Items {
+		h, err := recovery.NodeFaultHistory(&n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		if len(h.Faults) == 0 {
+			continue
+		}
+		last := h.Faults[len(h.Faults)-1]
+		quarantined := "-"
+		if kube.Quarantined(&n) {
+			quarantined = n.Annotations[constants.QuarantineReasonAnnotation]
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", n.Name, h.Count, last.Time.Format(time.RFC3339), oneLine(last.Reason), quarantined)
+	}
+	return nil
+}
+
+// runUnquarantine clears the quarantine of the nodes, they stay cordoned. The faults before the
+// clearance are kept in the history but no longer count for the quarantine.
+func runUnquarantine(cli kubernetes.Interface, args []string) error {
+	fs := flag.NewFlagSet("unquarantine", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("expect node names")
+	}
+	ctx := context.Background()
+	for _, name := range fs.Args() {
+		n, err := cli.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !kube.Quarantined(n) {
+			return fmt.Errorf("node %s is not quarantined", name)
+		}
+		if err := clearQuarantine(ctx, cli, n); err != nil {
+			return fmt.Errorf("clear quarantine of node %s error: %w", name, err)
+		}
+		fmt.Printf("node %s is no longer quarantined, mark it repaired or uncordon it to return it to service\n", name)
+	}
+	return nil
+}
+
+func clearQuarantine(ctx context.Context, cli kubernetes.Interface, n *corev1.Node) error {
+	h, err := recovery.NodeFaultHistory(n)
+	if err != nil {
+		h = recovery.FaultHistory{}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	h.ClearedAt = &now
+	data, err := h.Annotation()
+	if err != nil {
+		return err
+	}
+	if err := kube.PatchNodeAnnotations(ctx, cli, n.Name, map[string]*string{
+		constants.FaultHistoryAnnotation:     &data,
+		constants.QuarantineReasonAnnotation: nil,
+	}); err != nil {
+		return err
+	}
+	// the label is removed last, so a failed clearance can be retried
+	return kube.PatchNodeLabels(ctx, cli, n.Name, map[string]*string{constants.QuarantinedLabel: nil})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/kube"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// runRepaired marks the nodes repaired, the controller validates them and uncordons the ones
+// which pass. The mark is the time, so marking a node again starts a new validation.
+func runRepaired(cli kubernetes.Interface, args []string) error {
+	fs := flag.NewFlagSet("repaired", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("expect node names")
+	}
+	ctx := context.Background()
+	for _, name := range fs.Args() {
+		n, err := cli.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !kube.CordonedByKcover(n) {
+			return fmt.Errorf("node %s was not cordoned by kcover, there is nothing to validate", name)
+		}
+		if kube.Quarantined(n) {
+			return fmt.Errorf("node %s is quarantined, clear it with kcoverctl unquarantine first", name)
+		}
+		now := time.Now().Format(time.RFC3339)
+		if err := kube.PatchNodeAnnotations(ctx, cli, name, map[string]*string{
+			constants.RepairedAnnotation: &now,
+		}); err != nil {
+			return fmt.Errorf("mark node %s error: %w", name, err)
+		}
+		fmt.Printf("node %s marked repaired, it is uncordoned once the validation passes\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+func runTrigger(cli kubernetes.Interface, args []string) error {
+	fs := flag.NewFlagSet("trigger", flag.ContinueOnError)
+	var eventType, reason, message, device, api string
+	fs.StringVar(&eventType, "type", events.Error.String(), "type of the event, Error or Warning")
+	fs.StringVar(&reason, "reason", events.ReasonError, "reason of the event")
+	fs.StringVar(&message, "message", "triggered by kcoverctl", "message of the event")
+	fs.StringVar(&device, "device", "", "device of the node event, e.g. a GPU UUID")
+	fs.StringVar(&api, "events-api", string(events.CoreV1), "api of the event, v1 or events.k8s.io/v1")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("expect the target: pod <namespace>/<name> or node <name>")
+	}
+	e := events.CollectorEvent{
+		EventType: events.ParseEventType(eventType),
+		Reason:    reason,
+		Message:   message,
+	}
+	if !strings.EqualFold(e.EventType.String(), eventType) {
+		return fmt.Errorf("invalid event type %q", eventType)
+	}
+	switch fs.Arg(0) {
+	case "pod":
+		ns, name, ok := strings.Cut(fs.Arg(1), "/")
+		if !ok || ns == "" || name == "" {
+			return fmt.Errorf("invalid pod %q, expect <namespace>/<name>", fs.Arg(1))
+		}
+		e.TargetType, e.Namespace, e.Name = events.Pod, ns, name
+	case "node":
+		e.TargetType, e.Name = events.Node, fs.Arg(1)
+		if device != "" {
+			e.TargetType, e.Device = events.Device, device
+		}
+	default:
+		return fmt.Errorf("unknown target %q, expect pod or node", fs.Arg(0))
+	}
+
+	if err := events.API(api).Validate(); err != nil {
+		return err
+	}
+	recorder := events.NewKubeEventsRecorder(cli, false, events.API(api), events.DefaultWatchOptions, events.DefaultQueueOptions)
+	if err := recorder.Start(); err != nil {
+		return err
+	}
+	defer recorder.Stop()
+	start := time.Now().Add(-time.Second)
+	if err := recorder.RecordEvent(e); err != nil {
+		return err
+	}
+
+	// the events are sent in the background, wait for it before exiting
+	namespace := e.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	selector := fields.Set{"involvedObject.name": e.Name, "reason": e.Reason}.AsSelector().String()
+	err := wait.PollUntilContextTimeout(context.Background(), 500*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		list, err := listEvents(cli, namespace, metav1.ListOptions{FieldSelector: selector}, constants.NeedRecoveryAnnotation, start)
+		if err != nil {
+			return false, err
+		}
+		return len(list) > 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for the event to be recorded: %w", err)
+	}
+	fmt.Printf("recorded %s event %s of %s %s\n", e.EventType, e.Reason, e.TargetType, fs.Arg(1))
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func runUncordon(cli kubernetes.Interface, args []string) error {
+	fs := flag.NewFlagSet("uncordon", flag.ContinueOnError)
+	var all, force, dryRun bool
+	fs.BoolVar(&all, "all", false, "uncordon all the nodes cordoned by kcover")
+	fs.BoolVar(&force, "force", false, "uncordon the nodes even if they were not cordoned by kcover")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print the nodes to uncordon")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if all == (fs.NArg() > 0) {
+		return fmt.Errorf("expect either --all or node names")
+	}
+	ctx := context.Background()
+
+	var nodes []corev1.Node
+	if all {
+		list, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for _, n := range list.Items {
+			if !kube.CordonedByKcover(&n) {
+				continue
+			}
+			if kube.Quarantined(&n) {
+				fmt.Printf("node %s is quarantined, skipped\n", n.Name)
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+	} else {
+		for _, name := range fs.Args() {
+			n, err := cli.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !kube.CordonedByKcover(n) && !force {
+				return fmt.Errorf("node %s was not cordoned by kcover, use --force to uncordon it anyway", name)
+			}
+			if kube.Quarantined(n) {
+				return fmt.Errorf("node %s is quarantined, clear it with kcoverctl unquarantine first", name)
+			}
+			nodes = append(nodes, *n)
+		}
+	}
+
+	for _, n := range nodes {
+		reason := n.Annotations[constants.CordonReasonAnnotation]
+		if dryRun {
+			fmt.Printf("node %s would be uncordoned, cordoned at %s because of %s\n", n.Name, n.Annotations[constants.CordonedAtAnnotation], reason)
+			continue
+		}
+		if err := kube.RemoveNodeTaint(ctx, cli, n.Name, constants.UnhealthyTaintKey); err != nil {
+			return fmt.Errorf("remove taint of node %s error: %w", n.Name, err)
+		}
+		if err := kube.SetNodeUnschedulable(ctx, cli, n.Name, false); err != nil {
+			return fmt.Errorf("uncordon node %s error: %w", n.Name, err)
+		}
+		// the annotations are removed last, so a failed uncordon can be found and retried with --all
+		if err := kube.PatchNodeAnnotations(ctx, cli, n.Name, map[string]*string{
+			constants.CordonedAtAnnotation:   nil,
+			constants.CordonReasonAnnotation: nil,
+		}); err != nil {
+			return fmt.Errorf("remove annotations of node %s error: %w", n.Name, err)
+		}
+		fmt.Printf("node %s uncordoned\n", n.Name)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package alertmanager
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/jellydator/ttlcache/v3"
+	"k8s.io/klog/v2"
+)
+
+const Path = "/v1/alertmanager"
+
+// Message is the payload of the alertmanager webhook, see
+// https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+type Message struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Rule overrides how the alerts matching all the labels are mapped.
+type Rule struct {
+	Matchers map[string]string `json:"matchers"`
+	// TargetType is detected from the labels if it is empty
+	TargetType events.TargetType `json:"targetType,omitempty"`
+	// EventType is detected from the severity label if it is zero
+	EventType events.EventType `json:"eventType,omitempty"`
+	// Reason defaults to the alertname label
+	Reason string `json:"reason,omitempty"`
+	// Ignore drops the matching alerts
+	Ignore bool `json:"ignore,omitempty"`
+}
+
+// Options maps the alert labels to collector events, the first non-empty label of each list is used.
+type Options struct {
+	NodeLabels      []string `json:"nodeLabels"`
+	NamespaceLabels []string `json:"namespaceLabels"`
+	PodLabels       []string `json:"podLabels"`
+	DeviceLabels    []string `json:"deviceLabels"`
+	// ErrorSeverities are the values of the severity label mapped to Error, the others are Warning
+	ErrorSeverities []string `json:"errorSeverities"`
+	Rules           []Rule   `json:"rules,omitempty"`
+}
+
+var DefaultOptions = Options{
+	// dcgm-exporter uses Hostname, kube-state-metrics uses node
+	NodeLabels:      []string{"node", "Hostname", "kubernetes_node"},
+	NamespaceLabels: []string{"namespace", "exported_namespace"},
+	PodLabels:       []string{"pod", "exported_pod"},
+	DeviceLabels:    []string{"UUID", "device", "pci_bus_id"},
+	ErrorSeverities: []string{"critical", "error"},
+}
+
+// Auth of the webhook, alertmanager sends the bearer token or the basic auth of the http_config of
+// the receiver. The token is preferred if both are set.
+type Auth struct {
+	Token    string
+	Username string
+	Password string
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorized checks the credentials of the request, nothing is authorized without configured ones.
+func (a Auth) authorized(req *http.Request) bool {
+	if a.Token != "" {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		return ok && equal(token, a.Token)
+	}
+	if a.Username != "" {
+		username, password, ok := req.BasicAuth()
+		return ok && equal(username, a.Username) && equal(password, a.Password)
+	}
+	return false
+}
+
+// seenWindow in which an alert is accepted once. Alertmanager sends the alerts of a group again
+// with each change of the group and every repeat_interval while they are firing, they must not
+// restart the job again and again.
+const seenWindow = 24 * time.Hour
+
+var receivedAlerts = metrics.NewCounterVec("kcover_alertmanager_alerts_total",
+	"Number of alerts received from alertmanager by result.", "result")
+
+// Receiver converts the alerts posted by alertmanager to collector events. Like the events stream
+// only the leader has a sink, alertmanager retries the notifications rejected by the others.
+type Receiver struct {
+	auth Auth
+	// seen alerts by fingerprint and start time, a resolved alert firing again starts anew
+	seen *ttlcache.Cache[string, struct{}]
+
+	mu   sync.RWMutex
+	opts Options
+	sink *events.Queue[events.CollectorEvent]
+}
+
+// NewReceiver creates the receiver, it rejects all the notifications if auth is empty.
+func NewReceiver(opts Options, auth Auth) *Receiver {
+	return &Receiver{
+		opts: opts,
+		auth: auth,
+		seen: ttlcache.New[string, struct{}](
+			ttlcache.WithTTL[string, struct{}](seenWindow),
+			ttlcache.WithDisableTouchOnHit[string, struct{}](),
+		),
+	}
+}
+
+// SetSink sets the queue receiving the events, nil stops accepting alerts.
+func (r *Receiver) SetSink(sink *events.Queue[events.CollectorEvent]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sink = sink
+}
+
+// SetOptions replaces the options used by the alerts received from now on.
+func (r *Receiver) SetOptions(opts Options) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opts = opts
+}
+
+func (r *Receiver) getOptions() Options {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.opts
+}
+
+func (r *Receiver) getSink() *events.Queue[events.CollectorEvent] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sink
+}
+
+func firstLabel(labels map[string]string, names []string) string {
+	for _, name := range names {
+		if v := labels[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func matchRule(opts Options, labels map[string]string) *Rule {
+	for i, rule := range opts.Rules {
+		matched := true
+		for k, v := range rule.Matchers {
+			if labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &opts.Rules[i]
+		}
+	}
+	return nil
+}
+
+// ToEvent maps the alert to a collector event, it returns false if the alert should be ignored.
+func (r *Receiver) ToEvent(alert Alert) (events.CollectorEvent, bool, error) {
+	if alert.Status == "resolved" {
+		return events.CollectorEvent{}, false, nil
+	}
+	opts := r.getOptions()
+	rule := matchRule(opts, alert.Labels)
+	if rule != nil && rule.Ignore {
+		return events.CollectorEvent{}, false, nil
+	}
+
+	node := firstLabel(alert.Labels, opts.NodeLabels)
+	namespace := firstLabel(alert.Labels, opts.NamespaceLabels)
+	pod := firstLabel(alert.Labels, opts.PodLabels)
+	device := firstLabel(alert.Labels, opts.DeviceLabels)
+
+	e := events.CollectorEvent{
+		EventType: events.Warning,
+		Reason:    alert.Labels["alertname"],
+		Message:   firstLabel(alert.Annotations, []string{"summary", "description", "message"}),
+	}
+	for _, s := range opts.ErrorSeverities {
+		if strings.EqualFold(alert.Labels["severity"], s) {
+			e.EventType = events.Error
+		}
+	}
+	switch {
+	case rule != nil && rule.TargetType != "":
+		e.TargetType = rule.TargetType
+	case namespace != "" && pod != "":
+		e.TargetType = events.Pod
+	case node != "" && device != "":
+		e.TargetType = events.Device
+	case node != "":
+		e.TargetType = events.Node
+	default:
+		return e, false, fmt.Errorf("alert %s has no node or pod labels", alert.Labels["alertname"])
+	}
+	switch e.TargetType {
+	case events.Pod:
+		e.Namespace, e.Name = namespace, pod
+	case events.Device:
+		e.Name, e.Device = node, device
+	default:
+		e.Name = node
+	}
+	if e.Name == "" {
+		return e, false, fmt.Errorf("alert %s has no labels for %s target", alert.Labels["alertname"], e.TargetType)
+	}
+	if rule != nil {
+		if rule.EventType != 0 {
+			e.EventType = rule.EventType
+		}
+		if rule.Reason != "" {
+			e.Reason = rule.Reason
+		}
+	}
+	if e.Reason == "" {
+		e.Reason = events.ReasonError
+	}
+	if e.Message == "" {
+		e.Message = fmt.Sprintf("alert %s is firing since %s", e.Reason, alert.StartsAt.Format(time.RFC3339))
+	}
+	return e, true, nil
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.auth.authorized(req) {
+		receivedAlerts.WithLabelValues("unauthorized").Inc()
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kcover", Basic realm="kcover"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sink := r.getSink()
+	if sink == nil {
+		http.Error(w, "not leader", http.StatusServiceUnavailable)
+		return
+	}
+	var msg Message
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		http.Error(w, fmt.Sprintf("decode alertmanager message error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	accepted := 0
+	for _, alert := range msg.Alerts {
+		e, ok, err := r.ToEvent(alert)
+		if err != nil {
+			klog.Warningf("map alert %v error: %v", alert.Labels, err)
+			receivedAlerts.WithLabelValues("unmapped").Inc()
+			continue
+		}
+		if !ok {
+			receivedAlerts.WithLabelValues("ignored").Inc()
+			continue
+		}
+		key := alert.Fingerprint + "/" + alert.StartsAt.UTC().Format(time.RFC3339Nano)
+		if alert.Fingerprint != "" && r.seen.Get(key) != nil {
+			receivedAlerts.WithLabelValues("duplicate").Inc()
+			continue
+		}
+		if !sink.Push(e) {
+			receivedAlerts.WithLabelValues("dropped").Inc()
+			// let alertmanager retry the whole group
+			http.Error(w, "event queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		if alert.Fingerprint != "" {
+			r.seen.DeleteExpired()
+			r.seen.Set(key, struct{}{}, ttlcache.DefaultTTL)
+		}
+		receivedAlerts.WithLabelValues("accepted").Inc()
+		accepted++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{
+		"alerts":   len(msg.Alerts),
+		"accepted": accepted,
+	})
+}
@@ -0,0 +1,161 @@
+package alertmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/baizeai/kcover/pkg/events"
+)
+
+func post(t *testing.T, url string, setAuth func(*http.Request)) *http.Response {
+	t.Helper()
+	f, err := os.Open("testdata/dcgm-xid.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	req, err := http.NewRequest(http.MethodPost, url, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if setAuth != nil {
+		setAuth(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func drain(q *events.Queue[events.CollectorEvent]) []events.CollectorEvent {
+	var res []events.CollectorEvent
+	for {
+		select {
+		case e := <-q.C():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	expected := []events.CollectorEvent{
+		{
+			TargetType: events.Device,
+			Name:       "worker-a800-2",
+			Device:     "GPU-5c3a2b4e-8d1f-4c2a-9e3b-1a2b3c4d5e6f",
+			EventType:  events.Error,
+			Reason:     "GPUXidError",
+			Message:    "GPU 3 of worker-a800-2 reported XID 79, fallen off the bus",
+		},
+		{
+			TargetType: events.Pod,
+			Namespace:  "team-a",
+			Name:       "llama-worker-3",
+			EventType:  events.Warning,
+			Reason:     "TrainingStalled",
+			Message:    "no progress reported by llama-worker-3 for 15 minutes",
+		},
+	}
+	cases := []struct {
+		name     string
+		auth     Auth
+		setAuth  func(*http.Request)
+		status   int
+		expected []events.CollectorEvent
+	}{
+		{
+			name:     "bearer token",
+			auth:     Auth{Token: "secret"},
+			setAuth:  func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") },
+			status:   http.StatusOK,
+			expected: expected,
+		},
+		{
+			name:     "basic auth",
+			auth:     Auth{Username: "alertmanager", Password: "secret"},
+			setAuth:  func(req *http.Request) { req.SetBasicAuth("alertmanager", "secret") },
+			status:   http.StatusOK,
+			expected: expected,
+		},
+		{
+			name:    "wrong token",
+			auth:    Auth{Token: "secret"},
+			setAuth: func(req *http.Request) { req.Header.Set("Authorization", "Bearer guess") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "wrong password",
+			auth:    Auth{Username: "alertmanager", Password: "secret"},
+			setAuth: func(req *http.Request) { req.SetBasicAuth("alertmanager", "guess") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:   "no credentials",
+			auth:   Auth{Token: "secret"},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "nothing configured",
+			setAuth: func(req *http.Request) { req.Header.Set("Authorization", "Bearer ") },
+			status:  http.StatusUnauthorized,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewReceiver(DefaultOptions, c.auth)
+			q := events.NewQueue[events.CollectorEvent]("alertmanager-test", events.DefaultQueueOptions)
+			defer q.Close()
+			r.SetSink(q)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp := post(t, srv.URL+Path, c.setAuth)
+			if resp.StatusCode != c.status {
+				t.Fatalf("expect status %d, got %d", c.status, resp.StatusCode)
+			}
+			if got := drain(q); !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expect events %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestReceiverNotLeader(t *testing.T) {
+	r := NewReceiver(DefaultOptions, Auth{Token: "secret"})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp := post(t, srv.URL+Path, func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") })
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expect status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
+
+func TestReceiverRepeatedGroup(t *testing.T) {
+	r := NewReceiver(DefaultOptions, Auth{Token: "secret"})
+	q := events.NewQueue[events.CollectorEvent]("alertmanager-test", events.DefaultQueueOptions)
+	defer q.Close()
+	r.SetSink(q)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	setAuth := func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") }
+
+	// alertmanager sends the firing alerts of the group again every repeat_interval
+	for i, expected := range []int{2, 0} {
+		resp := post(t, srv.URL+Path, setAuth)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("post %d: expect status %d, got %d", i, http.StatusOK, resp.StatusCode)
+		}
+		if got := drain(q); len(got) != expected {
+			t.Errorf("post %d: expect %d events, got %+v", i, expected, got)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/nodehealth"
+	"github.com/baizeai/kcover/pkg/stream"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+const AgentKind = "AgentConfiguration"
+
+// AgentConfiguration configures cmd/collector-controller.
+type AgentConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MetricsAddr serves the metrics, empty disables it
+	MetricsAddr string     `json:"metricsAddr"`
+	EventQueue  EventQueue `json:"eventQueue"`
+	// EventsAPI records the fault events, v1 or events.k8s.io/v1
+	EventsAPI     events.API    `json:"eventsAPI"`
+	Stream        Stream        `json:"stream"`
+	NodeCondition NodeCondition `json:"nodeCondition"`
+	// SysfsRoot is the mount point of the sysfs of the node
+	SysfsRoot string `json:"sysfsRoot"`
+	// RepeatInterval of reporting a hardware problem which still exists
+	RepeatInterval metav1.Duration `json:"repeatInterval"`
+	Diagnostics    Diagnostics     `json:"diagnostics"`
+	// NodePools override the enabled diagnostics on the nodes matching their selectors, in order
+	NodePools []NodePool `json:"nodePools,omitempty"`
+	// ReloadInterval of checking the configuration file for changes, 0 disables the reload
+	ReloadInterval metav1.Duration `json:"reloadInterval"`
+}
+
+// NodePool enables or disables diagnostics on the nodes matching the selector, e.g. skip dcgm on
+// CPU nodes.
+type NodePool struct {
+	Name         string               `json:"name"`
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	// Enable and Disable are names of diagnostics, Disable wins if a name is in both
+	Enable  StringList `json:"enable,omitempty"`
+	Disable StringList `json:"disable,omitempty"`
+}
+
+type Stream struct {
+	// ControllerAddr is the base url of the controller, empty to only record kubernetes events
+	ControllerAddr string          `json:"controllerAddr,omitempty"`
+	SpoolDir       string          `json:"spoolDir"`
+	MaxSpooled     int             `json:"maxSpooled"`
+	FallbackAfter  metav1.Duration `json:"fallbackAfter"`
+	// TokenFile is the service account token authenticating the agent to the controller
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+func (s Stream) Options() stream.Options {
+	return stream.Options{
+		ControllerAddr: s.ControllerAddr,
+		SpoolDir:       s.SpoolDir,
+		MaxSpooled:     s.MaxSpooled,
+		FallbackAfter:  s.FallbackAfter.Duration,
+		TokenFile:      s.TokenFile,
+	}
+}
+
+type NodeCondition struct {
+	Enabled      bool            `json:"enabled"`
+	Interval     metav1.Duration `json:"interval"`
+	HealthyAfter metav1.Duration `json:"healthyAfter"`
+}
+
+func (n NodeCondition) Options() nodehealth.Options {
+	return nodehealth.Options{Interval: n.Interval.Duration, HealthyAfter: n.HealthyAfter.Duration}
+}
+
+// Diagnostics are the options of the diagnostics of the agent by name, see
+// diagnosis.RegisterAgent.
+type Diagnostics map[string]diagnosis.AgentOptions
+
+func newDiagnostics() Diagnostics {
+	d := Diagnostics{}
+	for _, name := range diagnosis.Registered() {
+		if opts, ok := diagnosis.NewAgentOptions(name); ok {
+			d[name] = opts
+		}
+	}
+	return d
+}
+
+// Names returns the sorted names of the diagnostics.
+func (d Diagnostics) Names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnmarshalJSON decodes the section of each diagnostic into its options, the fields absent from
+// the section keep their values.
+func (d *Diagnostics) UnmarshalJSON(bs []byte) error {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &sections); err != nil {
+		return err
+	}
+	for name, section := range sections {
+		opts, ok := (*d)[name]
+		if !ok {
+			return fmt.Errorf("unknown diagnostic %s, expect one of %v", name, d.Names())
+		}
+		dec := json.NewDecoder(bytes.NewReader(section))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(opts); err != nil {
+			return fmt.Errorf("invalid options of diagnostic %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EnabledDiagnostics returns the diagnostics to run on the node with the labels.
+func (c *AgentConfiguration) EnabledDiagnostics(nodeLabels map[string]string) ([]string, error) {
+	enabled := map[string]bool{}
+	for name, opts := range c.Diagnostics {
+		enabled[name] = opts.IsEnabled()
+	}
+	for _, pool := range c.NodePools {
+		selector, err := metav1.LabelSelectorAsSelector(&pool.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector of node pool %s: %w", pool.Name, err)
+		}
+		if !selector.Matches(labels.Set(nodeLabels)) {
+			continue
+		}
+		klog.Infof("node matches node pool %s", pool.Name)
+		for _, name := range pool.Enable {
+			enabled[name] = true
+		}
+		for _, name := range pool.Disable {
+			enabled[name] = false
+		}
+	}
+	var names []string
+	for _, name := range c.Diagnostics.Names() {
+		if enabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func NewAgentConfiguration() *AgentConfiguration {
+	return &AgentConfiguration{
+		TypeMeta:    metav1.TypeMeta{APIVersion: APIVersion, Kind: AgentKind},
+		MetricsAddr: ":8080",
+		EventQueue:  defaultEventQueue(),
+		EventsAPI:   events.CoreV1,
+		Stream: Stream{
+			SpoolDir:      "/var/lib/kcover/spool",
+			MaxSpooled:    1000,
+			FallbackAfter: duration(30 * time.Second),
+			TokenFile:     stream.DefaultTokenFile,
+		},
+		NodeCondition: NodeCondition{
+			Enabled:      true,
+			Interval:     duration(time.Minute),
+			HealthyAfter: duration(10 * time.Minute),
+		},
+		SysfsRoot:      "/sys",
+		RepeatInterval: duration(10 * time.Minute),
+		ReloadInterval: duration(10 * time.Second),
+		Diagnostics:    newDiagnostics(),
+	}
+}
+
+// CopyReloadable copies the fields applied to the running diagnostics when the file changes, the
+// others need a restart.
+func (c *AgentConfiguration) CopyReloadable(from *AgentConfiguration) {
+	c.SysfsRoot = from.SysfsRoot
+	c.RepeatInterval = from.RepeatInterval
+	c.Diagnostics = from.Diagnostics
+	c.NodePools = from.NodePools
+}
+
+func (c *AgentConfiguration) ExpectedKind() string {
+	return AgentKind
+}
+
+func (c *AgentConfiguration) GetTypeMeta() metav1.TypeMeta {
+	return c.TypeMeta
+}
+
+func (c *AgentConfiguration) SetDefaults() {
+	for _, opts := range c.Diagnostics {
+		if d, ok := opts.(interface{ SetDefaults() }); ok {
+			d.SetDefaults()
+		}
+	}
+}
+
+func (c *AgentConfiguration) Validate() field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, c.EventQueue.validate(field.NewPath("eventQueue"))...)
+	if c.EventsAPI.Validate() != nil {
+		errs = append(errs, field.NotSupported(field.NewPath("eventsAPI"), c.EventsAPI, []string{string(events.CoreV1), string(events.EventsV1)}))
+	}
+	if c.Stream.ControllerAddr != "" {
+		path := field.NewPath("stream")
+		if c.Stream.SpoolDir == "" {
+			errs = append(errs, field.Required(path.Child("spoolDir"), "required to stream events"))
+		}
+		if c.Stream.MaxSpooled <= 0 {
+			errs = append(errs, field.Invalid(path.Child("maxSpooled"), c.Stream.MaxSpooled, "must be positive"))
+		}
+		errs = ValidatePositive(errs, path.Child("fallbackAfter"), c.Stream.FallbackAfter)
+	}
+	if c.NodeCondition.Enabled {
+		errs = ValidatePositive(errs, field.NewPath("nodeCondition", "interval"), c.NodeCondition.Interval)
+		errs = ValidatePositive(errs, field.NewPath("nodeCondition", "healthyAfter"), c.NodeCondition.HealthyAfter)
+	}
+	errs = ValidatePositive(errs, field.NewPath("repeatInterval"), c.RepeatInterval)
+	if c.ReloadInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("reloadInterval"), c.ReloadInterval.Duration.String(), "must not be negative"))
+	}
+
+	known := sets.New(c.Diagnostics.Names()...)
+	// the diagnostics enabled by a node pool are validated as well
+	validated := sets.New[string]()
+	for name, opts := range c.Diagnostics {
+		if opts.IsEnabled() {
+			validated.Insert(name)
+		}
+	}
+	for i, pool := range c.NodePools {
+		path := field.NewPath("nodePools").Index(i)
+		if pool.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		}
+		if _, err := metav1.LabelSelectorAsSelector(&pool.NodeSelector); err != nil {
+			errs = append(errs, field.Invalid(path.Child("nodeSelector"), pool.NodeSelector, err.Error()))
+		}
+		for j, name := range pool.Enable {
+			if !known.Has(name) {
+				errs = append(errs, field.NotSupported(path.Child("enable").Index(j), name, c.Diagnostics.Names()))
+			}
+			validated.Insert(name)
+		}
+		for j, name := range pool.Disable {
+			if !known.Has(name) {
+				errs = append(errs, field.NotSupported(path.Child("disable").Index(j), name, c.Diagnostics.Names()))
+			}
+		}
+	}
+	path := field.NewPath("diagnostics")
+	for _, name := range c.Diagnostics.Names() {
+		if validated.Has(name) {
+			errs = append(errs, c.Diagnostics[name].Validate(path.Child(name))...)
+		}
+	}
+	return errs
+}
+
+// AddFlags binds the flags to the fields.
+func (c *AgentConfiguration) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "address to serve metrics on, empty to disable")
+	c.EventQueue.AddFlags(fs)
+	fs.StringVar((*string)(&c.EventsAPI), "events-api", string(c.EventsAPI), "api of the recorded fault events, v1 or events.k8s.io/v1")
+	fs.StringVar(&c.Stream.ControllerAddr, "controller-addr", c.Stream.ControllerAddr, "base url of the controller to stream events to, empty to only record kubernetes events")
+	fs.StringVar(&c.Stream.SpoolDir, "spool-dir", c.Stream.SpoolDir, "directory buffering the events not yet acknowledged by the controller")
+	fs.IntVar(&c.Stream.MaxSpooled, "max-spooled-events", c.Stream.MaxSpooled, "maximum number of buffered events, the oldest ones are dropped first")
+	fs.DurationVar(&c.Stream.FallbackAfter.Duration, "stream-fallback-after", c.Stream.FallbackAfter.Duration, "record events as kubernetes events if they are not acknowledged in this duration")
+	fs.StringVar(&c.Stream.TokenFile, "stream-token-file", c.Stream.TokenFile, "service account token authenticating the agent to the controller, empty to send none")
+	fs.BoolVar(&c.NodeCondition.Enabled, "node-condition", c.NodeCondition.Enabled, "maintain the KcoverGPUHealthy condition of the node")
+	fs.DurationVar(&c.NodeCondition.Interval.Duration, "node-condition-interval", c.NodeCondition.Interval.Duration, "interval of the node condition heartbeat")
+	fs.DurationVar(&c.NodeCondition.HealthyAfter.Duration, "node-condition-healthy-after", c.NodeCondition.HealthyAfter.Duration, "duration without faults before the node condition turns healthy again")
+	fs.StringVar(&c.SysfsRoot, "sysfs-root", c.SysfsRoot, "mount point of the sysfs of the node")
+	fs.DurationVar(&c.RepeatInterval.Duration, "repeat-interval", c.RepeatInterval.Duration, "interval of reporting a hardware problem which still exists")
+	fs.DurationVar(&c.ReloadInterval.Duration, "config-reload-interval", c.ReloadInterval.Duration, "interval of checking the config file for changes, 0 disables the reload")
+
+	for _, name := range c.Diagnostics.Names() {
+		c.Diagnostics[name].AddFlags(fs)
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis/npd"
+	"github.com/baizeai/kcover/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// APIVersion of the configuration files.
+const APIVersion = "kcover.io/v1alpha1"
+
+// EnvPrefix of the environment variables overriding the flags, e.g. KCOVER_METRICS_ADDR for --metrics-addr.
+const EnvPrefix = "KCOVER_"
+
+// Object is a configuration of a binary.
+type Object interface {
+	// ExpectedKind is the kind of the configuration files
+	ExpectedKind() string
+	GetTypeMeta() metav1.TypeMeta
+	// SetDefaults fills the fields which must be unset while loading the file, e.g. maps, which
+	// would be merged with the defaults instead of replaced
+	SetDefaults()
+	Validate() field.ErrorList
+	// AddFlags binds the flags to the fields
+	AddFlags(fs *flag.FlagSet)
+}
+
+// EventQueue configures the bounded event queues.
+type EventQueue struct {
+	Size           int                   `json:"size"`
+	OverflowPolicy events.OverflowPolicy `json:"overflowPolicy"`
+}
+
+func (q EventQueue) Options() events.QueueOptions {
+	return events.QueueOptions{Size: q.Size, Policy: q.OverflowPolicy}
+}
+
+func defaultEventQueue() EventQueue {
+	return EventQueue{Size: events.DefaultQueueOptions.Size, OverflowPolicy: events.DefaultQueueOptions.Policy}
+}
+
+func (q EventQueue) validate(path *field.Path) field.ErrorList {
+	if err := q.Options().Validate(); err != nil {
+		return field.ErrorList{field.Invalid(path, q, err.Error())}
+	}
+	return nil
+}
+
+func (q *EventQueue) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&q.Size, "event-queue-size", q.Size, "capacity of each event queue")
+	fs.StringVar((*string)(&q.OverflowPolicy), "event-queue-overflow-policy", string(q.OverflowPolicy), "policy when an event queue is full, DropOldest or DropNewest")
+}
+
+func ValidatePositive(errs field.ErrorList, path *field.Path, d metav1.Duration) field.ErrorList {
+	if d.Duration <= 0 {
+		errs = append(errs, field.Invalid(path, d.Duration.String(), "must be positive"))
+	}
+	return errs
+}
+
+func duration(d time.Duration) metav1.Duration {
+	return metav1.Duration{Duration: d}
+}
+
+// LoadFile loads the configuration file into obj, the fields absent from the file are kept.
+func LoadFile(path string, obj Object) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(bs, obj); err != nil {
+		return fmt.Errorf("parse %s error: %w", path, err)
+	}
+	tm := obj.GetTypeMeta()
+	if tm.APIVersion != APIVersion || tm.Kind != obj.ExpectedKind() {
+		return fmt.Errorf("%s is %s %s, expect %s %s", path, tm.APIVersion, tm.Kind, APIVersion, obj.ExpectedKind())
+	}
+	return nil
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Parse parses the flags bound to the fields of obj. The precedence is defaults < the file of
+// --config (or KCOVER_CONFIG) < environment variables < flags, the result is validated. The
+// returned loader reloads the file with the same overrides.
+func Parse(fs *flag.FlagSet, args []string, obj Object) (*Loader, error) {
+	path := fs.String("config", os.Getenv(envName("config")), fmt.Sprintf("configuration file of kind %s, the flags override it", obj.ExpectedKind()))
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *path != "" {
+		if err := LoadFile(*path, obj); err != nil {
+			return nil, err
+		}
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", envName(f.Name), err))
+			}
+			set[f.Name] = true
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if *path != "" {
+		// the file has overwritten the fields of the flags
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+	obj.SetDefaults()
+	if err := obj.Validate().ToAggregate(); err != nil {
+		return nil, err
+	}
+
+	loader := &Loader{Path: *path, overrides: map[string]string{}}
+	own := flag.NewFlagSet("", flag.ContinueOnError)
+	obj.AddFlags(own)
+	own.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			loader.overrides[f.Name] = fs.Lookup(f.Name).Value.String()
+		}
+	})
+	return loader, nil
+}
+
+// Loader loads the configuration file again, applying the flags and environment variables which
+// overrode it at startup.
+type Loader struct {
+	Path      string
+	overrides map[string]string
+}
+
+// Load loads the file into obj, which should be a new configuration with the defaults.
+func (l *Loader) Load(obj Object) error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	obj.AddFlags(fs)
+	if l.Path != "" {
+		if err := LoadFile(l.Path, obj); err != nil {
+			return err
+		}
+	}
+	for name, v := range l.overrides {
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	obj.SetDefaults()
+	return obj.Validate().ToAggregate()
+}
+
+// StringList is a flag of comma separated values.
+type StringList []string
+
+func (l *StringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(s string) error {
+	*l = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// Rules is a flag of rules like "key=Error,key=Warning", see npd.ParseRules.
+type Rules map[string]events.EventType
+
+func (r *Rules) String() string {
+	if r == nil {
+		return ""
+	}
+	return npd.FormatRules(*r)
+}
+
+func (r *Rules) Set(s string) error {
+	rules, err := npd.ParseRules(s)
+	if err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
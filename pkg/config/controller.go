@@ -0,0 +1,430 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/alertmanager"
+	"github.com/baizeai/kcover/pkg/diagnosis/ncclprobe"
+	"github.com/baizeai/kcover/pkg/diagnosis/npd"
+	"github.com/baizeai/kcover/pkg/diagnosis/podstatus"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/recovery"
+	"github.com/baizeai/kcover/pkg/stream"
+	"github.com/baizeai/kcover/pkg/validation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+const ControllerKind = "ControllerConfiguration"
+
+// ControllerConfiguration configures cmd/kcover.
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MetricsAddr serves the metrics, empty disables it
+	MetricsAddr string `json:"metricsAddr"`
+	// HTTPAddr serves the api receiving agent events and alerts, empty disables it
+	HTTPAddr string `json:"httpAddr"`
+	// Stream authenticates the agents streaming events to the http api
+	Stream         StreamServer   `json:"stream"`
+	LeaderElection LeaderElection `json:"leaderElection"`
+	Watch          Watch          `json:"watch"`
+	EventQueue     EventQueue     `json:"eventQueue"`
+	// EventsAPI records the fault events, the controller watches the events of both apis
+	EventsAPI events.API `json:"eventsAPI"`
+	// AggregationWindow in which fault events of the same job or node are aggregated into one incident
+	AggregationWindow metav1.Duration       `json:"aggregationWindow"`
+	Recovery          Recovery              `json:"recovery"`
+	Diagnostics       ControllerDiagnostics `json:"diagnostics"`
+	Validation        Validation            `json:"validation"`
+	// ReloadInterval of checking the configuration file for changes, 0 disables the reload
+	ReloadInterval metav1.Duration `json:"reloadInterval"`
+}
+
+// StreamServer accepts the events streamed by the agents authenticated with their pod bound
+// service account tokens, they may only report the faults of their nodes and the pods on them.
+type StreamServer struct {
+	// Audience of the agent tokens, empty accepts the tokens of the kubernetes api
+	Audience string `json:"audience"`
+	// ServiceAccounts of the agents as "<namespace>:<name>"
+	ServiceAccounts StringList `json:"serviceAccounts,omitempty"`
+}
+
+func (s StreamServer) Options(maxEventAge time.Duration) stream.ServerOptions {
+	return stream.ServerOptions{MaxEventAge: maxEventAge, Audience: s.Audience, ServiceAccounts: s.ServiceAccounts}
+}
+
+type LeaderElection struct {
+	LeaseName string `json:"leaseName"`
+	// LeaseNamespace defaults to the namespace of the pod
+	LeaseNamespace string          `json:"leaseNamespace,omitempty"`
+	LeaseDuration  metav1.Duration `json:"leaseDuration"`
+	RenewDeadline  metav1.Duration `json:"renewDeadline"`
+	RetryPeriod    metav1.Duration `json:"retryPeriod"`
+}
+
+type Watch struct {
+	// Resync of the informers
+	Resync metav1.Duration `json:"resync"`
+	// MaxEventAge is how long a fault event is considered fresh enough to trigger recovery
+	MaxEventAge metav1.Duration `json:"maxEventAge"`
+}
+
+func (w Watch) Options() events.WatchOptions {
+	return events.WatchOptions{Resync: w.Resync.Duration, MaxEventAge: w.MaxEventAge.Duration}
+}
+
+type Recovery struct {
+	Workers int `json:"workers"`
+	// RestartCooldown is the duration in which a restarted job is not restarted again
+	RestartCooldown metav1.Duration `json:"restartCooldown"`
+	Quarantine      Quarantine      `json:"quarantine"`
+}
+
+// Quarantine labels the nodes cordoned too often, they are only uncordoned after a manual clearance.
+type Quarantine struct {
+	// Faults in the window which quarantine a node, 0 disables the quarantine
+	Faults int             `json:"faults"`
+	Window metav1.Duration `json:"window"`
+}
+
+func (r Recovery) Options() recovery.Options {
+	return recovery.Options{
+		Workers:         r.Workers,
+		RestartCooldown: r.RestartCooldown.Duration,
+		Quarantine:      recovery.Quarantine{Faults: r.Quarantine.Faults, Window: r.Quarantine.Window.Duration},
+	}
+}
+
+// Validation runs a pod on the nodes cordoned by kcover once they are marked repaired, and
+// uncordons the nodes which pass.
+type Validation struct {
+	Enabled bool `json:"enabled"`
+	// Namespace of the validation pods, the namespace of the controller if empty
+	Namespace string `json:"namespace,omitempty"`
+	// PodTemplate of the validation, the node passes if the pod succeeds
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+	// Timeout of a validation including pulling the image
+	Timeout metav1.Duration `json:"timeout"`
+}
+
+func (v Validation) Options() validation.Options {
+	opts := validation.Options{Namespace: v.Namespace, Timeout: v.Timeout.Duration}
+	if v.PodTemplate != nil {
+		opts.Template = *v.PodTemplate
+	}
+	return opts
+}
+
+type ControllerDiagnostics struct {
+	PodStatus    PodStatus    `json:"podStatus"`
+	NPD          NPD          `json:"npd"`
+	Alertmanager Alertmanager `json:"alertmanager"`
+	NCCLProbe    NCCLProbe    `json:"ncclProbe"`
+}
+
+// NCCLProbe runs nccl-tests on the idle nodes matching the baselines.
+type NCCLProbe struct {
+	Enabled bool `json:"enabled"`
+	// Namespace of the probe pods, the namespace of the controller if empty
+	Namespace string `json:"namespace,omitempty"`
+	// PodTemplate of the probe, the first container prints the output of nccl-tests
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+	// Baselines are matched in order, the nodes matching none are not probed
+	Baselines []NCCLBaseline `json:"baselines,omitempty"`
+	// Interval of probing the same node
+	Interval metav1.Duration `json:"interval"`
+	// Timeout of a probe including pulling the image
+	Timeout       metav1.Duration `json:"timeout"`
+	MaxConcurrent int             `json:"maxConcurrent"`
+}
+
+type NCCLBaseline struct {
+	Name         string               `json:"name"`
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	// MinBusBandwidth in GB/s
+	MinBusBandwidth float64 `json:"minBusBandwidth"`
+}
+
+func (p NCCLProbe) Options() ncclprobe.Options {
+	opts := ncclprobe.Options{
+		Namespace:     p.Namespace,
+		Interval:      p.Interval.Duration,
+		Timeout:       p.Timeout.Duration,
+		MaxConcurrent: p.MaxConcurrent,
+	}
+	if p.PodTemplate != nil {
+		opts.Template = *p.PodTemplate
+	}
+	for _, b := range p.Baselines {
+		selector, err := metav1.LabelSelectorAsSelector(&b.NodeSelector)
+		if err != nil {
+			// rejected by the validation
+			selector = labels.Nothing()
+		}
+		opts.Baselines = append(opts.Baselines, ncclprobe.Baseline{Name: b.Name, Selector: selector, MinBusBandwidth: b.MinBusBandwidth})
+	}
+	return opts
+}
+
+type PodStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+type NPD struct {
+	Enabled bool `json:"enabled"`
+	// Conditions maps node condition types to event types, the defaults are used if empty
+	Conditions Rules `json:"conditions,omitempty"`
+	// Events maps "<source component>/<reason>" of node events to event types, the defaults are used if empty
+	Events Rules `json:"events,omitempty"`
+}
+
+type Alertmanager struct {
+	Enabled bool `json:"enabled"`
+	// TokenFile has the bearer token alertmanager sends, see the authorization of its http_config
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Username and PasswordFile are the basic auth alertmanager sends if there is no token
+	Username     string                `json:"username,omitempty"`
+	PasswordFile string                `json:"passwordFile,omitempty"`
+	Options      *alertmanager.Options `json:"options,omitempty"`
+}
+
+// Auth reads the credentials of the webhook from the files.
+func (a Alertmanager) Auth() (alertmanager.Auth, error) {
+	var auth alertmanager.Auth
+	if a.TokenFile != "" {
+		token, err := readSecret(a.TokenFile)
+		if err != nil {
+			return auth, err
+		}
+		auth.Token = token
+	}
+	if a.Username != "" {
+		password, err := readSecret(a.PasswordFile)
+		if err != nil {
+			return auth, err
+		}
+		auth.Username, auth.Password = a.Username, password
+	}
+	return auth, nil
+}
+
+func readSecret(path string) (string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret error: %w", err)
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+func NewControllerConfiguration() *ControllerConfiguration {
+	return &ControllerConfiguration{
+		TypeMeta:    metav1.TypeMeta{APIVersion: APIVersion, Kind: ControllerKind},
+		MetricsAddr: ":8080",
+		HTTPAddr:    ":8090",
+		Stream:      StreamServer{Audience: stream.DefaultAudience},
+		LeaderElection: LeaderElection{
+			LeaseName:     "kcover",
+			LeaseDuration: duration(15 * time.Second),
+			RenewDeadline: duration(10 * time.Second),
+			RetryPeriod:   duration(2 * time.Second),
+		},
+		Watch: Watch{
+			Resync:      duration(events.DefaultResync),
+			MaxEventAge: duration(events.DefaultMaxEventAge),
+		},
+		EventQueue:        defaultEventQueue(),
+		EventsAPI:         events.CoreV1,
+		AggregationWindow: duration(5 * time.Second),
+		Recovery: Recovery{
+			Workers:         recovery.DefaultOptions.Workers,
+			RestartCooldown: duration(recovery.DefaultOptions.RestartCooldown),
+			Quarantine: Quarantine{
+				Faults: recovery.DefaultOptions.Quarantine.Faults,
+				Window: duration(recovery.DefaultOptions.Quarantine.Window),
+			},
+		},
+		Diagnostics: ControllerDiagnostics{
+			PodStatus:    PodStatus{Enabled: true},
+			NPD:          NPD{Enabled: true},
+			Alertmanager: Alertmanager{Enabled: true},
+			NCCLProbe: NCCLProbe{
+				Interval:      duration(24 * time.Hour),
+				Timeout:       duration(10 * time.Minute),
+				MaxConcurrent: 1,
+			},
+		},
+		Validation:     Validation{Timeout: duration(30 * time.Minute)},
+		ReloadInterval: duration(10 * time.Second),
+	}
+}
+
+// CopyReloadable copies the fields applied to the running controller when the file changes, the
+// others need a restart.
+func (c *ControllerConfiguration) CopyReloadable(from *ControllerConfiguration) {
+	c.AggregationWindow = from.AggregationWindow
+	// the workers are started once
+	workers := c.Recovery.Workers
+	c.Recovery = from.Recovery
+	c.Recovery.Workers = workers
+	c.Diagnostics.NPD.Conditions = from.Diagnostics.NPD.Conditions
+	c.Diagnostics.NPD.Events = from.Diagnostics.NPD.Events
+	c.Diagnostics.Alertmanager.Options = from.Diagnostics.Alertmanager.Options
+}
+
+// DiagnosticOptions maps the enabled diagnostics of the registry to their options.
+func (c *ControllerConfiguration) DiagnosticOptions() map[string]any {
+	diags := map[string]any{}
+	if c.Diagnostics.PodStatus.Enabled {
+		diags[podstatus.Name] = nil
+	}
+	if c.Diagnostics.NPD.Enabled {
+		diags[npd.Name] = npd.Options{Conditions: c.Diagnostics.NPD.Conditions, Events: c.Diagnostics.NPD.Events}
+	}
+	if c.Diagnostics.NCCLProbe.Enabled {
+		diags[ncclprobe.Name] = c.Diagnostics.NCCLProbe.Options()
+	}
+	return diags
+}
+
+func (c *ControllerConfiguration) ExpectedKind() string {
+	return ControllerKind
+}
+
+func (c *ControllerConfiguration) GetTypeMeta() metav1.TypeMeta {
+	return c.TypeMeta
+}
+
+func (c *ControllerConfiguration) SetDefaults() {
+	if len(c.Diagnostics.NPD.Conditions) == 0 {
+		c.Diagnostics.NPD.Conditions = npd.DefaultOptions.Conditions
+	}
+	if len(c.Diagnostics.NPD.Events) == 0 {
+		c.Diagnostics.NPD.Events = npd.DefaultOptions.Events
+	}
+	if c.Diagnostics.Alertmanager.Options == nil {
+		opts := alertmanager.DefaultOptions
+		c.Diagnostics.Alertmanager.Options = &opts
+	}
+}
+
+func (c *ControllerConfiguration) Validate() field.ErrorList {
+	var errs field.ErrorList
+	le := c.LeaderElection
+	path := field.NewPath("leaderElection")
+	if le.LeaseName == "" {
+		errs = append(errs, field.Required(path.Child("leaseName"), ""))
+	}
+	errs = ValidatePositive(errs, path.Child("retryPeriod"), le.RetryPeriod)
+	if le.LeaseDuration.Duration <= le.RenewDeadline.Duration {
+		errs = append(errs, field.Invalid(path.Child("leaseDuration"), le.LeaseDuration.Duration.String(), "must be greater than renewDeadline"))
+	}
+	if float64(le.RenewDeadline.Duration) <= leaderelection.JitterFactor*float64(le.RetryPeriod.Duration) {
+		errs = append(errs, field.Invalid(path.Child("renewDeadline"), le.RenewDeadline.Duration.String(),
+			"must be greater than retryPeriod*1.2"))
+	}
+	for i, sa := range c.Stream.ServiceAccounts {
+		if namespace, name, ok := strings.Cut(sa, ":"); !ok || namespace == "" || name == "" {
+			errs = append(errs, field.Invalid(field.NewPath("stream", "serviceAccounts").Index(i), sa, "must be <namespace>:<name>"))
+		}
+	}
+	errs = ValidatePositive(errs, field.NewPath("watch", "resync"), c.Watch.Resync)
+	errs = ValidatePositive(errs, field.NewPath("watch", "maxEventAge"), c.Watch.MaxEventAge)
+	errs = append(errs, c.EventQueue.validate(field.NewPath("eventQueue"))...)
+	if c.EventsAPI.Validate() != nil {
+		errs = append(errs, field.NotSupported(field.NewPath("eventsAPI"), c.EventsAPI, []string{string(events.CoreV1), string(events.EventsV1)}))
+	}
+	if c.AggregationWindow.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("aggregationWindow"), c.AggregationWindow.Duration.String(), "must not be negative"))
+	}
+	if c.Recovery.Workers <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("recovery", "workers"), c.Recovery.Workers, "must be positive"))
+	}
+	errs = ValidatePositive(errs, field.NewPath("recovery", "restartCooldown"), c.Recovery.RestartCooldown)
+	if q := c.Recovery.Quarantine; q.Faults < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("recovery", "quarantine", "faults"), q.Faults, "must not be negative"))
+	} else if q.Faults > recovery.MaxFaults {
+		errs = append(errs, field.Invalid(field.NewPath("recovery", "quarantine", "faults"), q.Faults, fmt.Sprintf("must not exceed the %d faults kept in the history", recovery.MaxFaults)))
+	} else if q.Faults > 0 {
+		errs = ValidatePositive(errs, field.NewPath("recovery", "quarantine", "window"), q.Window)
+	}
+	if a := c.Diagnostics.Alertmanager; (a.Username == "") != (a.PasswordFile == "") {
+		errs = append(errs, field.Required(field.NewPath("diagnostics", "alertmanager", "passwordFile"), "username and passwordFile must be set together"))
+	}
+	if p := c.Diagnostics.NCCLProbe; p.Enabled {
+		path := field.NewPath("diagnostics", "ncclProbe")
+		if p.PodTemplate == nil || len(p.PodTemplate.Spec.Containers) == 0 {
+			errs = append(errs, field.Required(path.Child("podTemplate"), "a pod template with containers is required"))
+		}
+		if len(p.Baselines) == 0 {
+			errs = append(errs, field.Required(path.Child("baselines"), "only the nodes matching a baseline are probed"))
+		}
+		for i, b := range p.Baselines {
+			path := path.Child("baselines").Index(i)
+			if _, err := metav1.LabelSelectorAsSelector(&b.NodeSelector); err != nil {
+				errs = append(errs, field.Invalid(path.Child("nodeSelector"), b.NodeSelector, err.Error()))
+			}
+			if b.MinBusBandwidth <= 0 {
+				errs = append(errs, field.Invalid(path.Child("minBusBandwidth"), b.MinBusBandwidth, "must be positive"))
+			}
+		}
+		errs = ValidatePositive(errs, path.Child("interval"), p.Interval)
+		errs = ValidatePositive(errs, path.Child("timeout"), p.Timeout)
+		if p.MaxConcurrent <= 0 {
+			errs = append(errs, field.Invalid(path.Child("maxConcurrent"), p.MaxConcurrent, "must be positive"))
+		}
+	}
+	if v := c.Validation; v.Enabled {
+		path := field.NewPath("validation")
+		if v.PodTemplate == nil || len(v.PodTemplate.Spec.Containers) == 0 {
+			errs = append(errs, field.Required(path.Child("podTemplate"), "a pod template with containers is required"))
+		}
+		errs = ValidatePositive(errs, path.Child("timeout"), v.Timeout)
+	}
+	if c.ReloadInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("reloadInterval"), c.ReloadInterval.Duration.String(), "must not be negative"))
+	}
+	return errs
+}
+
+// AddFlags binds the flags to the fields.
+func (c *ControllerConfiguration) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "address to serve metrics on, empty to disable")
+	fs.StringVar(&c.HTTPAddr, "http-addr", c.HTTPAddr, "address to serve the api receiving agent events on, empty to disable")
+	fs.StringVar(&c.Stream.Audience, "stream-audience", c.Stream.Audience, "audience of the service account tokens of the agents, empty to accept the tokens of the kubernetes api")
+	fs.Var(&c.Stream.ServiceAccounts, "stream-service-accounts", "comma separated service accounts of the agents as <namespace>:<name>, which may stream events")
+	fs.StringVar(&c.LeaderElection.LeaseName, "leader-election-lease-name", c.LeaderElection.LeaseName, "name of the leader election lease")
+	fs.StringVar(&c.LeaderElection.LeaseNamespace, "leader-election-lease-namespace", c.LeaderElection.LeaseNamespace, "namespace of the leader election lease, the namespace of the pod if empty")
+	fs.DurationVar(&c.LeaderElection.LeaseDuration.Duration, "leader-election-lease-duration", c.LeaderElection.LeaseDuration.Duration, "duration the non-leaders wait before taking over the lease")
+	fs.DurationVar(&c.LeaderElection.RenewDeadline.Duration, "leader-election-renew-deadline", c.LeaderElection.RenewDeadline.Duration, "duration the leader retries renewing the lease before giving up")
+	fs.DurationVar(&c.LeaderElection.RetryPeriod.Duration, "leader-election-retry-period", c.LeaderElection.RetryPeriod.Duration, "interval of trying to acquire or renew the lease")
+	fs.DurationVar(&c.Watch.Resync.Duration, "informer-resync", c.Watch.Resync.Duration, "resync period of the informers")
+	fs.DurationVar(&c.Watch.MaxEventAge.Duration, "max-event-age", c.Watch.MaxEventAge.Duration, "fault events older than it are ignored")
+	c.EventQueue.AddFlags(fs)
+	fs.StringVar((*string)(&c.EventsAPI), "events-api", string(c.EventsAPI), "api of the recorded fault events, v1 or events.k8s.io/v1")
+	fs.DurationVar(&c.AggregationWindow.Duration, "aggregation-window", c.AggregationWindow.Duration, "window in which fault events of the same job or node are aggregated into one incident, 0 disables aggregation")
+	fs.IntVar(&c.Recovery.Workers, "recovery-workers", c.Recovery.Workers, "number of workers processing recovery actions in parallel")
+	fs.DurationVar(&c.Recovery.RestartCooldown.Duration, "restart-cooldown", c.Recovery.RestartCooldown.Duration, "duration in which a restarted job is not restarted again")
+	fs.IntVar(&c.Recovery.Quarantine.Faults, "quarantine-faults", c.Recovery.Quarantine.Faults, "faults in the quarantine window which quarantine a node until cleared by hand, 0 disables the quarantine")
+	fs.DurationVar(&c.Recovery.Quarantine.Window.Duration, "quarantine-window", c.Recovery.Quarantine.Window.Duration, "window in which the faults of a node are counted for the quarantine")
+	fs.BoolVar(&c.Diagnostics.PodStatus.Enabled, "pod-status", c.Diagnostics.PodStatus.Enabled, "collect faults from the status of pods")
+	fs.BoolVar(&c.Diagnostics.NPD.Enabled, "npd", c.Diagnostics.NPD.Enabled, "collect faults from node-problem-detector conditions and events")
+	fs.Var(&c.Diagnostics.NPD.Conditions, "npd-conditions", "node condition types of node-problem-detector mapped to event types (default "+npd.FormatRules(npd.DefaultOptions.Conditions)+")")
+	fs.Var(&c.Diagnostics.NPD.Events, "npd-events", "source/reason of node-problem-detector events mapped to event types (default "+npd.FormatRules(npd.DefaultOptions.Events)+")")
+	fs.BoolVar(&c.Diagnostics.Alertmanager.Enabled, "alertmanager", c.Diagnostics.Alertmanager.Enabled, "receive alertmanager webhook notifications as fault events")
+	fs.StringVar(&c.Diagnostics.Alertmanager.TokenFile, "alertmanager-token-file", c.Diagnostics.Alertmanager.TokenFile, "file of the bearer token alertmanager authenticates the webhook with")
+	fs.StringVar(&c.Diagnostics.Alertmanager.Username, "alertmanager-username", c.Diagnostics.Alertmanager.Username, "basic auth username of the alertmanager webhook, used if there is no token")
+	fs.StringVar(&c.Diagnostics.Alertmanager.PasswordFile, "alertmanager-password-file", c.Diagnostics.Alertmanager.PasswordFile, "file of the basic auth password of the alertmanager webhook")
+	fs.BoolVar(&c.Diagnostics.NCCLProbe.Enabled, "nccl-probe", c.Diagnostics.NCCLProbe.Enabled, "probe the bus bandwidth of idle nodes with nccl-tests, the pod template and baselines are set by the config file")
+	fs.IntVar(&c.Diagnostics.NCCLProbe.MaxConcurrent, "nccl-probe-max-concurrent", c.Diagnostics.NCCLProbe.MaxConcurrent, "maximum number of nccl probes running at the same time")
+	fs.BoolVar(&c.Validation.Enabled, "validation", c.Validation.Enabled, "validate the nodes cordoned by kcover once they are marked repaired before uncordoning them, the pod template is set by the config file")
+	fs.DurationVar(&c.Validation.Timeout.Duration, "validation-timeout", c.Validation.Timeout.Duration, "timeout of the validation of a repaired node")
+	fs.DurationVar(&c.ReloadInterval.Duration, "config-reload-interval", c.ReloadInterval.Duration, "interval of checking the config file for changes, 0 disables the reload")
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*Watcher)(nil)
+
+// Watcher polls the configuration file for changes. kubelet updates a mounted ConfigMap by
+// swapping a symlink, so the content is compared instead of watching the file.
+type Watcher struct {
+	loader   *Loader
+	interval time.Duration
+	newObj   func() Object
+	onChange func(Object)
+	onError  func(error)
+	last     []byte
+	stop     chan struct{}
+}
+
+// NewWatcher calls onChange with the reloaded configuration, which newObj creates with the
+// defaults, or onError if it is invalid.
+func NewWatcher(loader *Loader, interval time.Duration, newObj func() Object, onChange func(Object), onError func(error)) *Watcher {
+	return &Watcher{
+		loader:   loader,
+		interval: interval,
+		newObj:   newObj,
+		onChange: onChange,
+		onError:  onError,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Start() error {
+	bs, err := os.ReadFile(w.loader.Path)
+	if err != nil {
+		return err
+	}
+	w.last = bs
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+	return nil
+}
+
+func (w *Watcher) check() {
+	bs, err := os.ReadFile(w.loader.Path)
+	if err != nil {
+		// the symlinks are swapped while the ConfigMap is updated
+		klog.Warningf("read config %s error: %v", w.loader.Path, err)
+		return
+	}
+	if bytes.Equal(bs, w.last) {
+		return
+	}
+	w.last = bs
+	obj := w.newObj()
+	if err := w.loader.Load(obj); err != nil {
+		w.onError(err)
+		return
+	}
+	w.onChange(obj)
+}
+
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
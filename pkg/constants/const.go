@@ -5,8 +5,42 @@ const (
 
 	// recovery annotations
 	NeedRecoveryAnnotation = "kcover.io/need-recovery"
+	EventTypeAnnotation    = "kcover.io/event-type"
+	DeviceAnnotation       = "kcover.io/device"
 
 	EnabledRecoveryLabel = "kcover.io/cascading-recovery"
 
+	// FieldManager owns the fields patched by kcover
+	FieldManager = "kcover"
+
+	// node recovery
+	UnhealthyTaintKey      = "kcover.io/unhealthy"
+	CordonedAtAnnotation   = "kcover.io/cordoned-at"
+	CordonReasonAnnotation = "kcover.io/cordon-reason"
+
+	// node validation, a node cordoned by kcover is validated once marked repaired
+	RepairedAnnotation         = "kcover.io/repaired"
+	ValidatedAtAnnotation      = "kcover.io/validated-at"
+	ValidationResultAnnotation = "kcover.io/validation-result"
+
+	// fault history of the nodes, nodes with too many faults are quarantined until cleared by hand
+	FaultHistoryAnnotation     = "kcover.io/fault-history"
+	QuarantinedLabel           = "kcover.io/quarantined"
+	QuarantineReasonAnnotation = "kcover.io/quarantine-reason"
+
+	// ActionAnnotation marks the events of the recovery actions taken by kcover
+	ActionAnnotation = "kcover.io/action"
+	// DecisionAnnotation marks the events of the recoveries skipped or failed by kcover
+	DecisionAnnotation = "kcover.io/decision"
+
+	// ProbeLabel marks the probe pods created by kcover, the value is the kind of the probe
+	ProbeLabel = "kcover.io/probe"
+
+	// LeaderLabel marks the controller pod which is the leader, the service only selects it
+	LeaderLabel = "kcover.io/leader"
+
+	// GPUHealthyCondition is the node condition maintained by the agent
+	GPUHealthyCondition = "KcoverGPUHealthy"
+
 	True = "true"
 )
@@ -0,0 +1,189 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*clockDiag)(nil)
+var _ diagnosis.Diagnostic = (*clockDiag)(nil)
+
+const (
+	ReasonClockSkew            = "ClockSkew"
+	ReasonClockNotSynchronized = "ClockNotSynchronized"
+)
+
+type Options struct {
+	Interval time.Duration
+	// MaxSkew is the maximum difference between the node and the apiserver clocks
+	MaxSkew time.Duration
+	// CheckSync reports the node when the kernel says its clock is not synchronized, nodes
+	// without ntp should disable it
+	CheckSync bool
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+type clockDiag struct {
+	nodeName string
+	opts     Options
+	host     string
+	client   *http.Client
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	// only accessed by the check loop
+	fired map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "clock"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.RestConfig == nil {
+			return nil, fmt.Errorf("the clock diagnostic needs the config of the apiserver")
+		}
+		return NewClockDiagnosis(ctx.NodeName, ctx.RestConfig, conf.Options(ctx), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewConfig()
+	})
+}
+
+func NewClockDiagnosis(nodeName string, cfg *rest.Config, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 10 * time.Second
+	host, _, err := rest.DefaultServerUrlFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &clockDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		host:     strings.TrimSuffix(host.String(), "/"),
+		client:   client,
+		events:   events.NewQueue[events.CollectorEvent]("clock", queueOpts),
+		stop:     make(chan struct{}),
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *clockDiag) Start() error {
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := d.check(time.Now()); err != nil {
+					klog.Errorf("check clock error: %v", err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *clockDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *clockDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// syncStatus returns whether the kernel clock is synchronized by ntp and its estimated error.
+func syncStatus() (bool, time.Duration, error) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return false, 0, err
+	}
+	synced := state != unix.TIME_ERROR && tx.Status&unix.STA_UNSYNC == 0
+	return synced, time.Duration(tx.Esterror) * time.Microsecond, nil
+}
+
+// apiserverSkew returns the difference between the local clock and the Date header of the apiserver,
+// and the uncertainty of it caused by the round trip and the resolution of the header.
+func (d *clockDiag) apiserverSkew() (time.Duration, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.host+"/version", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	sent := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	received := time.Now()
+	_ = resp.Body.Close()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid date header %q: %w", resp.Header.Get("Date"), err)
+	}
+	rtt := received.Sub(sent)
+	local := sent.Add(rtt / 2)
+	// the header is truncated to seconds
+	remote := date.Add(500 * time.Millisecond)
+	return local.Sub(remote), rtt/2 + 500*time.Millisecond, nil
+}
+
+func (d *clockDiag) check(now time.Time) error {
+	if d.opts.CheckSync {
+		synced, esterror, err := syncStatus()
+		if err != nil {
+			klog.Warningf("get clock sync status error: %v", err)
+		} else if !synced {
+			d.report(ReasonClockNotSynchronized, fmt.Sprintf("node clock is not synchronized, estimated error %v", esterror), now)
+		}
+	}
+
+	skew, uncertainty, err := d.apiserverSkew()
+	if err != nil {
+		return err
+	}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs-uncertainty > d.opts.MaxSkew {
+		d.report(ReasonClockSkew, fmt.Sprintf("node clock is %v off the apiserver clock, above %v", skew.Round(time.Millisecond), d.opts.MaxSkew), now)
+	}
+	return nil
+}
+
+func (d *clockDiag) report(reason, message string, now time.Time) {
+	if t, ok := d.fired[reason]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		return
+	}
+	d.fired[reason] = now
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       d.nodeName,
+		EventType:  events.Warning,
+		Reason:     reason,
+		Message:    message,
+	})
+}
@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the clock section of the configuration of the agent.
+type Config struct {
+	Enabled   bool            `json:"enabled"`
+	Interval  metav1.Duration `json:"interval"`
+	MaxSkew   metav1.Duration `json:"maxSkew"`
+	CheckSync bool            `json:"checkSync"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:   true,
+		Interval:  metav1.Duration{Duration: 5 * time.Minute},
+		MaxSkew:   metav1.Duration{Duration: 2 * time.Second},
+		CheckSync: true,
+	}
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	errs := config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+	return config.ValidatePositive(errs, path.Child("maxSkew"), c.MaxSkew)
+}
+
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Enabled, "clock", c.Enabled, "check the clock skew between the node and the apiserver")
+	fs.DurationVar(&c.Interval.Duration, "clock-interval", c.Interval.Duration, "interval of checking the clock")
+	fs.DurationVar(&c.MaxSkew.Duration, "clock-max-skew", c.MaxSkew.Duration, "maximum skew between the node and the apiserver clocks")
+	fs.BoolVar(&c.CheckSync, "clock-check-sync", c.CheckSync, "report nodes whose clock is not synchronized by ntp")
+}
+
+func (c *Config) Options(ctx diagnosis.Context) Options {
+	return Options{
+		Interval:       c.Interval.Duration,
+		MaxSkew:        c.MaxSkew.Duration,
+		CheckSync:      c.CheckSync,
+		RepeatInterval: ctx.RepeatInterval,
+	}
+}
@@ -4,34 +4,55 @@ import (
 	"fmt"
 
 	"github.com/baizeai/kcover/pkg/diagnosis"
-	"github.com/baizeai/kcover/pkg/diagnosis/podstatus"
+	"github.com/baizeai/kcover/pkg/diagnosis/npd"
+	// registers the pod status collector
+	_ "github.com/baizeai/kcover/pkg/diagnosis/podstatus"
 	"github.com/baizeai/kcover/pkg/events"
 	"github.com/baizeai/kcover/pkg/runner"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
-var _ runner.Runner = (*controllerDiagnostic)(nil)
+var _ Diagnostic = (*controllerDiagnostic)(nil)
+
+// Diagnostic runs the diagnostics of the controller.
+type Diagnostic interface {
+	runner.Runner
+	// SetNPDOptions replaces the rules of the node-problem-detector collector if it is enabled
+	SetNPDOptions(opts npd.Options)
+}
 
 type controllerDiagnostic struct {
-	diagnostics []diagnosis.Diagnostic
+	diagnostics map[string]diagnosis.Diagnostic
 	recorder    events.Recorder
 }
 
-func NewControllerDiagnostic(cli kubernetes.Interface, recorder events.Recorder) (runner.Runner, error) {
-	diags := make([]diagnosis.Diagnostic, 0)
-
-	diagPodCollector, err := podstatus.NewPodStatusCollector(cli)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create pod status collector: %v", err)
-	}
-
-	diags = append(diags, diagPodCollector)
+type Options struct {
+	Queue events.QueueOptions
+	Watch events.WatchOptions
+	// Diagnostics are the names of the registered diagnostics to run mapped to their options
+	Diagnostics map[string]any
+}
 
+func NewControllerDiagnostic(cli kubernetes.Interface, recorder events.Recorder, opts Options) (Diagnostic, error) {
 	if recorder == nil {
 		return nil, fmt.Errorf("recorder can not be nil")
 	}
 
+	diags := make(map[string]diagnosis.Diagnostic, len(opts.Diagnostics))
+	for name, diagOpts := range opts.Diagnostics {
+		d, err := diagnosis.New(name, diagnosis.Context{
+			Client:  cli,
+			Watch:   opts.Watch,
+			Queue:   opts.Queue,
+			Options: diagOpts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		diags[name] = d
+	}
+
 	return &controllerDiagnostic{
 		diagnostics: diags,
 		recorder:    recorder,
@@ -44,15 +65,15 @@ func (c *controllerDiagnostic) Start() error {
 			return err
 		}
 	}
-	for _, d := range c.diagnostics {
-		go func(d diagnosis.Diagnostic) {
+	for name, d := range c.diagnostics {
+		go func(name string, d diagnosis.Diagnostic) {
 			for e := range d.Events() {
 				err := c.recorder.RecordEvent(e)
 				if err != nil {
-					klog.Errorf("failed to record event of %T: %v", d, err)
+					klog.Errorf("failed to record event of %s: %v", name, err)
 				}
 			}
-		}(d)
+		}(name, d)
 	}
 
 	return nil
@@ -63,3 +84,9 @@ func (c *controllerDiagnostic) Stop() {
 		d.Stop()
 	}
 }
+
+func (c *controllerDiagnostic) SetNPDOptions(opts npd.Options) {
+	if r, ok := c.diagnostics[npd.Name].(interface{ SetOptions(npd.Options) }); ok {
+		r.SetOptions(opts)
+	}
+}
@@ -0,0 +1,56 @@
+package edac
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the edac section of the configuration of the agent.
+type Config struct {
+	Enabled               bool            `json:"enabled"`
+	Interval              metav1.Duration `json:"interval"`
+	MaxCorrectablePerHour float64         `json:"maxCorrectablePerHour"`
+	// KmsgPath is the kernel log to follow for machine checks, empty disables it
+	KmsgPath string `json:"kmsgPath"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:               true,
+		Interval:              metav1.Duration{Duration: time.Minute},
+		MaxCorrectablePerHour: 50,
+		KmsgPath:              "/dev/kmsg",
+	}
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	return config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+}
+
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Enabled, "edac", c.Enabled, "check the host memory errors and machine checks")
+	fs.DurationVar(&c.Interval.Duration, "edac-interval", c.Interval.Duration, "interval of checking the edac counters")
+	fs.Float64Var(&c.MaxCorrectablePerHour, "edac-max-correctable-per-hour", c.MaxCorrectablePerHour, "maximum increase of the correctable memory errors of a memory controller in the trailing hour")
+	fs.StringVar(&c.KmsgPath, "kmsg-path", c.KmsgPath, "kernel log to follow for machine checks, empty to disable")
+}
+
+func (c *Config) Options(ctx diagnosis.Context) Options {
+	return Options{
+		SysfsRoot:             ctx.SysfsRoot,
+		Interval:              c.Interval.Duration,
+		MaxCorrectablePerHour: c.MaxCorrectablePerHour,
+		KmsgPath:              c.KmsgPath,
+		RepeatInterval:        ctx.RepeatInterval,
+	}
+}
@@ -0,0 +1,324 @@
+package edac
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*edacDiag)(nil)
+var _ diagnosis.Diagnostic = (*edacDiag)(nil)
+
+const (
+	ReasonCorrectableMemoryErrors   = "CorrectableMemoryErrors"
+	ReasonUncorrectableMemoryErrors = "UncorrectableMemoryErrors"
+	ReasonMachineCheck              = "MachineCheck"
+	ReasonUncorrectableMachineCheck = "UncorrectableMachineCheck"
+)
+
+type Options struct {
+	// SysfsRoot is the mount point of sysfs, tests may point it to a fake tree
+	SysfsRoot string
+	Interval  time.Duration
+	// MaxCorrectablePerHour is the maximum increase of the ce_count of a memory controller in the
+	// trailing hour
+	MaxCorrectablePerHour float64
+	// KmsgPath is the kernel log to follow for machine checks, empty disables it. Regular files
+	// are followed like tail -f.
+	KmsgPath string
+	// ErrorPatterns match the kernel log lines of uncorrectable errors, the others matching
+	// WarningPatterns are reported as warnings
+	ErrorPatterns   []string
+	WarningPatterns []string
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+// kernelPrefix matches the start of the kernel messages in /dev/kmsg records, dmesg output and
+// syslog files, so that the patterns only match the messages of the machine check and EDAC drivers
+// and not e.g. the uncorrectable errors of PCIe AER or NVMe.
+const kernelPrefix = `(?:^|kernel: )(?:\[ *[0-9.]+\] )?`
+
+var (
+	DefaultErrorPatterns = []string{
+		kernelPrefix + `mce: .*[Uu]ncorrected`,
+		kernelPrefix + `Machine check: .*[Uu]ncorrected`,
+		kernelPrefix + `Kernel panic - not syncing: Fatal [Mm]achine check`,
+		kernelPrefix + `EDAC .*\bUE\b`,
+	}
+	DefaultWarningPatterns = []string{
+		kernelPrefix + `mce: \[Hardware Error\]`,
+		kernelPrefix + `mce: .*[Mm]achine check events logged`,
+	}
+)
+
+// ceWindow in which the correctable errors are counted
+const ceWindow = time.Hour
+
+type ceSample struct {
+	count uint64
+	time  time.Time
+}
+
+type mcCounters struct {
+	ue uint64
+	// ce samples of the window, the oldest first. The first one is the latest sample before the
+	// window, the base of the increase.
+	ce []ceSample
+}
+
+type edacDiag struct {
+	nodeName string
+	opts     Options
+	errors   []*regexp.Regexp
+	warnings []*regexp.Regexp
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+	kmsg     *os.File
+	lines    chan string
+
+	// only accessed by the check loop
+	mcs   map[string]mcCounters
+	fired map[string]time.Time
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Name of the diagnostic in the registry.
+const Name = "edac"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewEDACDiagnosis(ctx.NodeName, conf.Options(ctx), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewConfig()
+	})
+}
+
+func NewEDACDiagnosis(nodeName string, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	if opts.ErrorPatterns == nil {
+		opts.ErrorPatterns = DefaultErrorPatterns
+	}
+	if opts.WarningPatterns == nil {
+		opts.WarningPatterns = DefaultWarningPatterns
+	}
+	errPatterns, err := compile(opts.ErrorPatterns)
+	if err != nil {
+		return nil, err
+	}
+	warnPatterns, err := compile(opts.WarningPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &edacDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		errors:   errPatterns,
+		warnings: warnPatterns,
+		events:   events.NewQueue[events.CollectorEvent]("edac", queueOpts),
+		stop:     make(chan struct{}),
+		lines:    make(chan string, 64),
+		mcs:      map[string]mcCounters{},
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *edacDiag) Start() error {
+	if d.opts.KmsgPath != "" {
+		// the memory counters are still checked if the kernel log is not readable in the container
+		if f, err := os.Open(d.opts.KmsgPath); err != nil {
+			klog.Warningf("open kernel log %s error, machine checks are not detected: %v", d.opts.KmsgPath, err)
+		} else {
+			// only the messages after the agent started are interesting, /dev/kmsg supports
+			// seeking to the end as well
+			if _, err := f.Seek(0, io.SeekEnd); err != nil {
+				klog.Warningf("seek to the end of %s error: %v", d.opts.KmsgPath, err)
+			}
+			d.kmsg = f
+			go d.followKmsg()
+		}
+	}
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := d.check(time.Now()); err != nil {
+					klog.Errorf("check edac counters error: %v", err)
+				}
+			case line := <-d.lines:
+				d.checkLine(line, time.Now())
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *edacDiag) Stop() {
+	close(d.stop)
+	if d.kmsg != nil {
+		_ = d.kmsg.Close()
+	}
+	d.events.Close()
+}
+
+func (d *edacDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// followKmsg sends the messages of the kernel log to the check loop until the log is closed.
+func (d *edacDiag) followKmsg() {
+	// every read of /dev/kmsg returns one record, the buffer must be larger than a record
+	r := bufio.NewReaderSize(d.kmsg, 16*1024)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" && strings.HasSuffix(line, "\n") {
+			select {
+			case d.lines <- kmsgMessage(strings.TrimSuffix(line, "\n")):
+			case <-d.stop:
+				return
+			}
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			// regular files are followed
+			select {
+			case <-time.After(time.Second):
+			case <-d.stop:
+				return
+			}
+		case errors.Is(err, syscall.EPIPE):
+			// the records were overwritten before being read
+			klog.Warningf("kernel log %s overrun, some messages are lost", d.opts.KmsgPath)
+		default:
+			select {
+			case <-d.stop:
+			default:
+				klog.Errorf("read kernel log %s error: %v", d.opts.KmsgPath, err)
+			}
+			return
+		}
+	}
+}
+
+// kmsgMessage returns the message of /dev/kmsg records like "3,1234,5678,-;text", other lines
+// are returned as is.
+func kmsgMessage(line string) string {
+	if prefix, msg, ok := strings.Cut(line, ";"); ok && strings.Count(prefix, ",") >= 2 && !strings.ContainsAny(prefix, " \t") {
+		return msg
+	}
+	return line
+}
+
+func (d *edacDiag) checkLine(line string, now time.Time) {
+	// continuation lines of records start with a space
+	if line == "" || strings.HasPrefix(line, " ") {
+		return
+	}
+	for _, re := range d.errors {
+		if re.MatchString(line) {
+			d.report(ReasonUncorrectableMachineCheck, ReasonUncorrectableMachineCheck, events.Error, line, now)
+			return
+		}
+	}
+	for _, re := range d.warnings {
+		if re.MatchString(line) {
+			d.report(ReasonMachineCheck, ReasonMachineCheck, events.Warning, line, now)
+			return
+		}
+	}
+}
+
+func readCount(path string) (uint64, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(bs)), 10, 64)
+}
+
+func (d *edacDiag) check(now time.Time) error {
+	dirs, err := filepath.Glob(filepath.Join(d.opts.SysfsRoot, "devices", "system", "edac", "mc", "mc*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		mc := filepath.Base(dir)
+		ce, err1 := readCount(filepath.Join(dir, "ce_count"))
+		ue, err2 := readCount(filepath.Join(dir, "ue_count"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		cur := ceSample{count: ce, time: now}
+		prev, ok := d.mcs[mc]
+		// the counters are reset on boot, the errors before the agent started are not reported
+		if !ok || ce < prev.ce[len(prev.ce)-1].count || ue < prev.ue {
+			d.mcs[mc] = mcCounters{ue: ue, ce: []ceSample{cur}}
+			continue
+		}
+		if !now.After(prev.ce[len(prev.ce)-1].time) {
+			continue
+		}
+		if ue > prev.ue {
+			d.report(mc, ReasonUncorrectableMemoryErrors, events.Error,
+				fmt.Sprintf("memory controller %s reported %d uncorrectable errors, %d in total", mc, ue-prev.ue, ue), now)
+		}
+		samples := append(prev.ce, cur)
+		for len(samples) > 1 && !samples[1].time.After(now.Add(-ceWindow)) {
+			samples = samples[1:]
+		}
+		d.mcs[mc] = mcCounters{ue: ue, ce: samples}
+		// the increase is not extrapolated to an hour, a single error is never above the threshold
+		if base := samples[0]; float64(ce-base.count) > d.opts.MaxCorrectablePerHour {
+			d.report(mc, ReasonCorrectableMemoryErrors, events.Warning,
+				fmt.Sprintf("memory controller %s reported %d correctable errors in %v, %d in total", mc, ce-base.count, now.Sub(base.time).Round(time.Second), ce), now)
+		}
+	}
+	return nil
+}
+
+func (d *edacDiag) report(key, reason string, eventType events.EventType, message string, now time.Time) {
+	key = reason + "/" + key
+	if t, ok := d.fired[key]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		return
+	}
+	d.fired[key] = now
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       d.nodeName,
+		EventType:  eventType,
+		Reason:     reason,
+		Message:    message,
+	})
+}
@@ -0,0 +1,135 @@
+package edac
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+)
+
+func TestCheckLine(t *testing.T) {
+	cases := []struct {
+		line   string
+		reason string
+	}{
+		{"mce: Uncorrected hardware memory error in user-access at 3b1f7c1000", ReasonUncorrectableMachineCheck},
+		{"mce: [Hardware Error]: Machine check: Processor context corrupt, uncorrected error", ReasonUncorrectableMachineCheck},
+		{"Machine check: Data load in unrecoverable area of kernel, Uncorrected", ReasonUncorrectableMachineCheck},
+		{"Kernel panic - not syncing: Fatal machine check", ReasonUncorrectableMachineCheck},
+		{"EDAC MC0: 1 UE memory read error on CPU_SrcID#0_Ha#0_Chan#1_DIMM#0", ReasonUncorrectableMachineCheck},
+		{"[ 1234.567890] EDAC skx MC2: HANDLING MCE MEMORY ERROR UE", ReasonUncorrectableMachineCheck},
+		{"Jun  1 08:00:00 worker-a800-2 kernel: [ 1234.567890] mce: Uncorrected hardware memory error", ReasonUncorrectableMachineCheck},
+		{"mce: [Hardware Error]: CPU 12: Machine Check: 0 Bank 7: cc00008000010090", ReasonMachineCheck},
+		{"mce: 3 machine check events logged", ReasonMachineCheck},
+		{"EDAC MC0: 1 CE memory read error on CPU_SrcID#0_Ha#0_Chan#1_DIMM#0", ""},
+		{"pcieport 0000:00:01.0: AER: Uncorrected (Non-Fatal) error received: 0000:3b:00.0", ""},
+		{"pcieport 0000:00:01.0: AER: Uncorrectable (Fatal) error received: 0000:3b:00.0", ""},
+		{"nvme nvme0: uncorrectable read error on sector 123456", ""},
+		{"sd 2:0:0:0: [sdb] tag#3 Sense Key : Medium Error [current] Add. Sense: Unrecovered read error - auto reallocate failed", ""},
+		{"blk_update_request: critical medium error, dev sdb, sector 2048, uncorrectable", ""},
+		{"NVRM: Xid (PCI:0000:3b:00): 48, pid=1234, An uncorrectable double bit error (DBE) has been detected", ""},
+		{" continuation of mce: Uncorrected", ""},
+	}
+	for _, c := range cases {
+		diag, err := NewEDACDiagnosis("worker-a800-2", Options{Interval: time.Minute}, events.DefaultQueueOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := diag.(*edacDiag)
+		d.checkLine(c.line, time.Now())
+		select {
+		case e := <-d.Events():
+			if e.Reason != c.reason {
+				t.Errorf("line %q: expect reason %q, got %q", c.line, c.reason, e.Reason)
+			}
+		default:
+			if c.reason != "" {
+				t.Errorf("line %q: expect reason %q, got no event", c.line, c.reason)
+			}
+		}
+	}
+}
+
+func TestKmsgMessage(t *testing.T) {
+	cases := map[string]string{
+		"3,1234,5678901,-;mce: Uncorrected hardware memory error": "mce: Uncorrected hardware memory error",
+		"4,99,100,c;EDAC MC0: 1 UE memory read error":             "EDAC MC0: 1 UE memory read error",
+		"Jun  1 08:00:00 host kernel: mce: 3; not a record":       "Jun  1 08:00:00 host kernel: mce: 3; not a record",
+	}
+	for line, expected := range cases {
+		if got := kmsgMessage(line); got != expected {
+			t.Errorf("kmsgMessage(%q) = %q, expect %q", line, got, expected)
+		}
+	}
+}
+
+func TestCheckCorrectable(t *testing.T) {
+	root := t.TempDir()
+	mc := filepath.Join(root, "devices", "system", "edac", "mc", "mc0")
+	if err := os.MkdirAll(mc, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	setCounts := func(ce, ue int) {
+		for name, v := range map[string]int{"ce_count": ce, "ue_count": ue} {
+			if err := os.WriteFile(filepath.Join(mc, name), []byte(strconv.Itoa(v)+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	diag, err := NewEDACDiagnosis("worker-a800-2", Options{SysfsRoot: root, Interval: time.Minute, MaxCorrectablePerHour: 50, RepeatInterval: time.Minute}, events.DefaultQueueOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := diag.(*edacDiag)
+
+	start := time.Now()
+	cases := []struct {
+		minute int
+		ce, ue int
+		reason string
+	}{
+		{minute: 0, ce: 100},
+		// a single error in a minute is not 60 per hour
+		{minute: 1, ce: 101},
+		{minute: 30, ce: 140},
+		// 51 in the last 59 minutes
+		{minute: 60, ce: 152, reason: ReasonCorrectableMemoryErrors},
+		// the errors of minute 1 have left the window, 40 in the last hour
+		{minute: 90, ce: 180},
+		{minute: 91, ce: 180, ue: 1, reason: ReasonUncorrectableMemoryErrors},
+		// the counters are reset by reloading the driver
+		{minute: 92, ce: 0},
+		{minute: 93, ce: 10},
+	}
+	for _, c := range cases {
+		setCounts(c.ce, c.ue)
+		if err := d.check(start.Add(time.Duration(c.minute) * time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		var reasons []string
+		for _, e := range drain(d) {
+			reasons = append(reasons, e.Reason)
+		}
+		switch {
+		case c.reason == "" && len(reasons) > 0:
+			t.Errorf("minute %d: expect no events, got %v", c.minute, reasons)
+		case c.reason != "" && (len(reasons) != 1 || reasons[0] != c.reason):
+			t.Errorf("minute %d: expect reason %s, got %v", c.minute, c.reason, reasons)
+		}
+	}
+}
+
+func drain(d *edacDiag) []events.CollectorEvent {
+	var res []events.CollectorEvent
+	for {
+		select {
+		case e := <-d.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
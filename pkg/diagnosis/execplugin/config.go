@@ -0,0 +1,83 @@
+package execplugin
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the exec section of the configuration of the agent, see Plugin for the output the
+// commands print.
+type Config struct {
+	Plugins []PluginConfig `json:"plugins,omitempty"`
+}
+
+type PluginConfig struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	// Interval defaults to 1m
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Timeout defaults to 30s
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// SetDefaults sets the interval and timeout of the plugins without them.
+func (c *Config) SetDefaults() {
+	for i := range c.Plugins {
+		p := &c.Plugins[i]
+		if p.Interval.Duration == 0 {
+			p.Interval = metav1.Duration{Duration: time.Minute}
+		}
+		if p.Timeout.Duration == 0 {
+			p.Timeout = metav1.Duration{Duration: 30 * time.Second}
+		}
+	}
+}
+
+func (c *Config) IsEnabled() bool {
+	return len(c.Plugins) > 0
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := sets.New[string]()
+	for i, p := range c.Plugins {
+		path := path.Child("plugins").Index(i)
+		switch {
+		case p.Name == "":
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		case names.Has(p.Name):
+			errs = append(errs, field.Duplicate(path.Child("name"), p.Name))
+		}
+		names.Insert(p.Name)
+		if len(p.Command) == 0 {
+			errs = append(errs, field.Required(path.Child("command"), ""))
+		}
+		errs = config.ValidatePositive(errs, path.Child("interval"), p.Interval)
+		errs = config.ValidatePositive(errs, path.Child("timeout"), p.Timeout)
+	}
+	return errs
+}
+
+// AddFlags adds no flags, the plugins are only configured by the file.
+func (c *Config) AddFlags(fs *flag.FlagSet) {}
+
+func (c *Config) Options(ctx diagnosis.Context) Options {
+	opts := Options{RepeatInterval: ctx.RepeatInterval}
+	for _, p := range c.Plugins {
+		opts.Plugins = append(opts.Plugins, Plugin{
+			Name:     p.Name,
+			Command:  p.Command,
+			Interval: p.Interval.Duration,
+			Timeout:  p.Timeout.Duration,
+		})
+	}
+	return opts
+}
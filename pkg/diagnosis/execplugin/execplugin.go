@@ -0,0 +1,296 @@
+package execplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*execDiag)(nil)
+var _ diagnosis.Diagnostic = (*execDiag)(nil)
+
+const (
+	// ReasonCheckFailed is the reason of the failures without a reason
+	ReasonCheckFailed  = "HealthCheckFailed"
+	ReasonCheckTimeout = "HealthCheckTimeout"
+)
+
+// exit codes of the plugins which do not print json, like the nagios plugins
+const (
+	exitOK      = 0
+	exitWarning = 1
+	exitError   = 2
+)
+
+// maxOutput of a plugin which is read, the rest is dropped
+const maxOutput = 64 * 1024
+
+// Plugin is a command run periodically. It reports by printing json objects, one per line:
+//
+//	{"status": "error", "target": "device", "device": "GPU-0", "reason": "GPUBurnFailed", "message": "..."}
+//
+// status is ok, warning or error, target is node (the default) or device. Without json on
+// stdout the exit code is the status, 0 ok, 1 warning and 2 error, and the first line of the
+// output is the message. Other exit codes mean the plugin itself failed and are only logged.
+type Plugin struct {
+	Name     string
+	Command  []string
+	Interval time.Duration
+	// Timeout kills the plugin, a hanging plugin is reported because it is often a hanging device
+	Timeout time.Duration
+}
+
+type Options struct {
+	Plugins []Plugin
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+// Result is a line of the json output of a plugin.
+type Result struct {
+	Status  string `json:"status"`
+	Target  string `json:"target,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type execDiag struct {
+	nodeName string
+	opts     Options
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	mu    sync.Mutex
+	fired map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "exec"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewExecDiagnosis(ctx.NodeName, conf.Options(ctx), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return &Config{}
+	})
+}
+
+func NewExecDiagnosis(nodeName string, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	for _, p := range opts.Plugins {
+		if len(p.Command) == 0 {
+			return nil, fmt.Errorf("plugin %s has no command", p.Name)
+		}
+		if p.Interval <= 0 || p.Timeout <= 0 {
+			return nil, fmt.Errorf("plugin %s needs a positive interval and timeout", p.Name)
+		}
+	}
+	return &execDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		events:   events.NewQueue[events.CollectorEvent]("exec", queueOpts),
+		stop:     make(chan struct{}),
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *execDiag) Start() error {
+	for _, p := range d.opts.Plugins {
+		go func(p Plugin) {
+			t := time.NewTicker(p.Interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					d.check(p, time.Now())
+				case <-d.stop:
+					return
+				}
+			}
+		}(p)
+	}
+	return nil
+}
+
+func (d *execDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *execDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// limitedBuffer keeps the first maxOutput bytes and discards the rest, so that a chatty plugin
+// neither blocks on a full pipe nor grows the memory of the agent.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// run executes the plugin, it returns the exit code, -1 if the plugin did not exit normally.
+func (d *execDiag) run(p Plugin) (stdout, stderr []byte, code int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Env = append(os.Environ(), "NODE_NAME="+d.nodeName)
+	// kill the children of shell scripts as well
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	var outBuf, errBuf limitedBuffer
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return outBuf.Bytes(), errBuf.Bytes(), -1, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		code = 0
+	case errors.As(err, &exitErr) && exitErr.Exited():
+		code, err = exitErr.ExitCode(), nil
+	default:
+		code = -1
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), code, err
+}
+
+func (d *execDiag) check(p Plugin, now time.Time) {
+	stdout, stderr, code, err := d.run(p)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		d.report(p, Result{Status: "warning", Reason: ReasonCheckTimeout,
+			Message: fmt.Sprintf("did not exit in %v", p.Timeout)}, now)
+		return
+	case err != nil:
+		klog.Errorf("run plugin %s error: %v", p.Name, err)
+		return
+	}
+
+	if trimmed := bytes.TrimSpace(stdout); bytes.HasPrefix(trimmed, []byte("{")) {
+		results, err := ParseResults(trimmed)
+		if err != nil {
+			klog.Errorf("plugin %s printed invalid json: %v", p.Name, err)
+			return
+		}
+		for _, res := range results {
+			d.report(p, res, now)
+		}
+		return
+	}
+
+	res := Result{Message: firstLine(stdout)}
+	if res.Message == "" {
+		res.Message = firstLine(stderr)
+	}
+	switch code {
+	case exitOK:
+		res.Status = "ok"
+	case exitWarning:
+		res.Status = "warning"
+	case exitError:
+		res.Status = "error"
+	default:
+		klog.Errorf("plugin %s exited with %d: %s", p.Name, code, firstLine(stderr))
+		return
+	}
+	d.report(p, res, now)
+}
+
+// ParseResults parses the json objects printed by a plugin.
+func ParseResults(output []byte) ([]Result, error) {
+	var results []Result
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var res Result
+		if err := dec.Decode(&res); errors.Is(err, io.EOF) {
+			return results, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(res.Status) {
+		case "ok", "warning", "error":
+		default:
+			return nil, fmt.Errorf("invalid status %q", res.Status)
+		}
+		switch strings.ToLower(res.Target) {
+		case "", "node":
+		case "device":
+			if res.Device == "" {
+				return nil, fmt.Errorf("result of target device has no device")
+			}
+		default:
+			return nil, fmt.Errorf("invalid target %q", res.Target)
+		}
+		results = append(results, res)
+	}
+}
+
+func firstLine(output []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func (d *execDiag) report(p Plugin, res Result, now time.Time) {
+	var eventType events.EventType
+	switch strings.ToLower(res.Status) {
+	case "warning":
+		eventType = events.Warning
+	case "error":
+		eventType = events.Error
+	default:
+		return
+	}
+	reason := res.Reason
+	if reason == "" {
+		reason = ReasonCheckFailed
+	}
+	key := p.Name + "/" + reason + "/" + res.Device
+	d.mu.Lock()
+	if t, ok := d.fired[key]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.fired[key] = now
+	d.mu.Unlock()
+
+	e := events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       d.nodeName,
+		EventType:  eventType,
+		Reason:     reason,
+		Message:    fmt.Sprintf("plugin %s: %s", p.Name, res.Message),
+	}
+	if res.Device != "" {
+		e.TargetType = events.Device
+		e.Device = res.Device
+	}
+	d.events.Push(e)
+}
@@ -0,0 +1,114 @@
+package execplugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+)
+
+const testNode = "worker-a800-2"
+
+func drain(d *execDiag) []events.CollectorEvent {
+	var res []events.CollectorEvent
+	for {
+		select {
+		case e := <-d.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		script   string
+		expected []events.CollectorEvent
+	}{
+		{script: "ok.sh"},
+		{
+			script: "warning.sh",
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Warning,
+				Reason:     ReasonCheckFailed,
+				Message:    "plugin warning.sh: fan speed of PSU 1 is low",
+			}},
+		},
+		{
+			script: "error.sh",
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Error,
+				Reason:     ReasonCheckFailed,
+				Message:    "plugin error.sh: memory test failed",
+			}},
+		},
+		{
+			script: "devices.sh",
+			expected: []events.CollectorEvent{
+				{
+					TargetType: events.Device,
+					Name:       testNode,
+					Device:     "GPU-1",
+					EventType:  events.Error,
+					Reason:     "GPUBurnFailed",
+					Message:    "plugin devices.sh: gpu-burn found 12 errors",
+				},
+				{
+					TargetType: events.Node,
+					Name:       testNode,
+					EventType:  events.Warning,
+					Reason:     "NVLinkDegraded",
+					Message:    "plugin devices.sh: " + testNode + " has 11 of 12 NVLinks up",
+				},
+			},
+		},
+		{script: "broken.sh"},
+	}
+	for _, c := range cases {
+		t.Run(c.script, func(t *testing.T) {
+			p := Plugin{Name: c.script, Command: []string{"testdata/" + c.script}, Interval: time.Minute, Timeout: 10 * time.Second}
+			diag, err := NewExecDiagnosis(testNode, Options{Plugins: []Plugin{p}, RepeatInterval: time.Hour}, events.DefaultQueueOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := diag.(*execDiag)
+
+			d.check(p, time.Now())
+			if got := drain(d); !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expect events %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	p := Plugin{Name: "hang", Command: []string{"testdata/hang.sh"}, Interval: time.Minute, Timeout: 500 * time.Millisecond}
+	diag, err := NewExecDiagnosis(testNode, Options{Plugins: []Plugin{p}, RepeatInterval: time.Hour}, events.DefaultQueueOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := diag.(*execDiag)
+
+	start := time.Now()
+	d.check(p, start)
+	// the sleep child holds the pipes open, it must be killed with the shell
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expect the plugin killed at the timeout, it ran for %v", elapsed)
+	}
+	expected := []events.CollectorEvent{{
+		TargetType: events.Node,
+		Name:       testNode,
+		EventType:  events.Warning,
+		Reason:     ReasonCheckTimeout,
+		Message:    "plugin hang: did not exit in 500ms",
+	}}
+	if got := drain(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect events %+v, got %+v", expected, got)
+	}
+}
@@ -0,0 +1,4 @@
+#!/bin/sh
+# the plugin itself failed, only logged
+echo "nvidia-smi: command not found" >&2
+exit 127
@@ -0,0 +1,5 @@
+#!/bin/sh
+# json results, one per line
+echo '{"status": "ok", "target": "device", "device": "GPU-0"}'
+echo '{"status": "error", "target": "device", "device": "GPU-1", "reason": "GPUBurnFailed", "message": "gpu-burn found 12 errors"}'
+echo '{"status": "warning", "reason": "NVLinkDegraded", "message": "'"$NODE_NAME"' has 11 of 12 NVLinks up"}'
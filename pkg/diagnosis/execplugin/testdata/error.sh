@@ -0,0 +1,4 @@
+#!/bin/sh
+# an error of the node, the message is read from stderr without stdout
+echo "memory test failed" >&2
+exit 2
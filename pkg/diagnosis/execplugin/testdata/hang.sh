@@ -0,0 +1,4 @@
+#!/bin/sh
+# hangs with a child process, like nvidia-smi on a GPU fallen off the bus
+sleep 600 &
+wait
@@ -0,0 +1,4 @@
+#!/bin/sh
+# a warning of the node, reported by the exit code
+echo "fan speed of PSU 1 is low"
+exit 1
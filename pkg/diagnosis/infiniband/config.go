@@ -0,0 +1,55 @@
+package infiniband
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the infiniband section of the configuration of the agent.
+type Config struct {
+	Enabled  bool            `json:"enabled"`
+	Interval metav1.Duration `json:"interval"`
+	// ExpectedPorts like mlx5_0/1 must be active
+	ExpectedPorts config.StringList `json:"expectedPorts,omitempty"`
+	// MinRate in Gb/sec, the first seen rate is expected if it is zero
+	MinRate float64 `json:"minRate,omitempty"`
+	// CounterThresholds are the maximum increase per minute of the error counters
+	CounterThresholds map[string]float64 `json:"counterThresholds,omitempty"`
+}
+
+func NewConfig() *Config {
+	return &Config{Enabled: true, Interval: metav1.Duration{Duration: 30 * time.Second}}
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	return config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+}
+
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Enabled, "infiniband", c.Enabled, "check the link health of infiniband and RoCE ports")
+	fs.DurationVar(&c.Interval.Duration, "infiniband-interval", c.Interval.Duration, "interval of checking infiniband ports")
+	fs.Var(&c.ExpectedPorts, "infiniband-expected-ports", "comma separated ports like mlx5_0/1 which must be active")
+	fs.Float64Var(&c.MinRate, "infiniband-min-rate", c.MinRate, "minimum rate of the ports in Gb/sec, the first seen rate is expected if it is zero")
+}
+
+func (c *Config) Options(ctx diagnosis.Context) Options {
+	return Options{
+		SysfsRoot:         ctx.SysfsRoot,
+		Interval:          c.Interval.Duration,
+		ExpectedPorts:     c.ExpectedPorts,
+		MinRate:           c.MinRate,
+		CounterThresholds: c.CounterThresholds,
+		RepeatInterval:    ctx.RepeatInterval,
+	}
+}
@@ -0,0 +1,272 @@
+package infiniband
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*ibDiag)(nil)
+var _ diagnosis.Diagnostic = (*ibDiag)(nil)
+
+const (
+	ReasonLinkDown      = "InfiniBandLinkDown"
+	ReasonRateDegraded  = "InfiniBandRateDegraded"
+	ReasonCounterGrowth = "InfiniBandCounterGrowth"
+
+	stateActive     = "ACTIVE"
+	physStateLinkUp = "LinkUp"
+)
+
+type Options struct {
+	// SysfsRoot is the mount point of sysfs, tests may point it to a fake tree
+	SysfsRoot string
+	Interval  time.Duration
+	// ExpectedPorts, in the form of "<device>/<port>" like mlx5_0/1, are reported when they are not active
+	// even if they have never been seen active by the agent
+	ExpectedPorts []string
+	// MinRate in Gb/sec, ports below it are degraded, if it is zero the rate first seen is used
+	MinRate float64
+	// CounterThresholds are the maximum increase per minute of the error counters
+	CounterThresholds map[string]float64
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+var DefaultCounterThresholds = map[string]float64{
+	"symbol_error":    10,
+	"link_downed":     0,
+	"port_rcv_errors": 10,
+}
+
+type portState struct {
+	seenActive bool
+	rate       float64
+	counters   map[string]uint64
+	time       time.Time
+}
+
+type ibDiag struct {
+	nodeName string
+	opts     Options
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	// only accessed by the check loop
+	ports map[string]*portState
+	fired map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "infiniband"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewInfiniBandDiagnosis(ctx.NodeName, conf.Options(ctx), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewConfig()
+	})
+}
+
+func NewInfiniBandDiagnosis(nodeName string, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	if opts.CounterThresholds == nil {
+		opts.CounterThresholds = DefaultCounterThresholds
+	}
+	return &ibDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		events:   events.NewQueue[events.CollectorEvent]("infiniband", queueOpts),
+		stop:     make(chan struct{}),
+		ports:    map[string]*portState{},
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *ibDiag) Start() error {
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := d.check(time.Now()); err != nil {
+					klog.Errorf("check infiniband ports error: %v", err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *ibDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *ibDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+func readString(path string) (string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// stateName returns the name of sysfs states like "4: ACTIVE".
+func stateName(s string) string {
+	if _, name, ok := strings.Cut(s, ":"); ok {
+		return strings.TrimSpace(name)
+	}
+	return s
+}
+
+// parseRate parses rates like "200 Gb/sec (4X HDR)".
+func parseRate(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty rate")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// listPorts returns the ports in the form of "<device>/<port>".
+func (d *ibDiag) listPorts() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(d.opts.SysfsRoot, "class", "infiniband", "*", "ports", "*"))
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]string, 0, len(matches))
+	for _, m := range matches {
+		port := filepath.Base(m)
+		device := filepath.Base(filepath.Dir(filepath.Dir(m)))
+		ports = append(ports, device+"/"+port)
+	}
+	for _, p := range d.opts.ExpectedPorts {
+		if _, ok := d.ports[p]; !ok {
+			d.ports[p] = &portState{seenActive: true}
+		}
+	}
+	for p := range d.ports {
+		ports = append(ports, p)
+	}
+	sort.Strings(ports)
+	res := ports[:0]
+	for i, p := range ports {
+		if i == 0 || ports[i-1] != p {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func (d *ibDiag) check(now time.Time) error {
+	ports, err := d.listPorts()
+	if err != nil {
+		return err
+	}
+	for _, port := range ports {
+		device, num, _ := strings.Cut(port, "/")
+		dir := filepath.Join(d.opts.SysfsRoot, "class", "infiniband", device, "ports", num)
+		st, ok := d.ports[port]
+		if !ok {
+			st = &portState{}
+			d.ports[port] = st
+		}
+		d.checkPort(port, dir, st, now)
+	}
+	return nil
+}
+
+func (d *ibDiag) checkPort(port, dir string, st *portState, now time.Time) {
+	state, err := readString(filepath.Join(dir, "state"))
+	if err != nil {
+		if st.seenActive {
+			d.report(port, ReasonLinkDown, events.Error, fmt.Sprintf("port %s is missing: %v", port, err), now)
+		}
+		return
+	}
+	physState, _ := readString(filepath.Join(dir, "phys_state"))
+	if stateName(state) != stateActive || (physState != "" && stateName(physState) != physStateLinkUp) {
+		if st.seenActive {
+			d.report(port, ReasonLinkDown, events.Error, fmt.Sprintf("port %s is down, state: %s, physical state: %s", port, state, physState), now)
+		}
+		return
+	}
+	st.seenActive = true
+
+	if rateStr, err := readString(filepath.Join(dir, "rate")); err == nil {
+		if rate, err := parseRate(rateStr); err == nil {
+			expected := d.opts.MinRate
+			if expected <= 0 {
+				if st.rate == 0 {
+					st.rate = rate
+				}
+				expected = st.rate
+			}
+			if rate < expected {
+				d.report(port, ReasonRateDegraded, events.Warning, fmt.Sprintf("port %s rate is %s, below the expected %g Gb/sec", port, rateStr, expected), now)
+			}
+		}
+	}
+
+	counters := map[string]uint64{}
+	for name := range d.opts.CounterThresholds {
+		s, err := readString(filepath.Join(dir, "counters", name))
+		if err != nil {
+			continue
+		}
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[name] = v
+	}
+	if st.counters != nil && now.After(st.time) {
+		minutes := now.Sub(st.time).Minutes()
+		for name, v := range counters {
+			prev, ok := st.counters[name]
+			if !ok || v < prev {
+				continue
+			}
+			if perMinute := float64(v-prev) / minutes; perMinute > d.opts.CounterThresholds[name] {
+				d.report(port+"/"+name, ReasonCounterGrowth, events.Warning,
+					fmt.Sprintf("port %s counter %s increased by %d in %v", port, name, v-prev, now.Sub(st.time).Round(time.Second)), now)
+			}
+		}
+	}
+	st.counters = counters
+	st.time = now
+}
+
+func (d *ibDiag) report(key, reason string, eventType events.EventType, message string, now time.Time) {
+	key = reason + "/" + key
+	if t, ok := d.fired[key]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		return
+	}
+	d.fired[key] = now
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       d.nodeName,
+		EventType:  eventType,
+		Reason:     reason,
+		Message:    message,
+	})
+}
@@ -0,0 +1,260 @@
+package infiniband
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+)
+
+const testNode = "worker-a800-2"
+
+// copySysfs copies the fake sysfs tree of testdata, so that the cases can change it.
+func copySysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	err := filepath.WalkDir("testdata/sysfs", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel("testdata/sysfs", path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, bs, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func portFile(root, port, name string) string {
+	device, num := filepath.Split(port)
+	return filepath.Join(root, "class", "infiniband", filepath.Clean(device), "ports", num, name)
+}
+
+func write(t *testing.T, root, port, name, value string) {
+	t.Helper()
+	if err := os.WriteFile(portFile(root, port, name), []byte(value+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func drain(d *ibDiag) []events.CollectorEvent {
+	var res []events.CollectorEvent
+	for {
+		select {
+		case e := <-d.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name string
+		opts Options
+		// change the tree between the first and the second check
+		change   func(t *testing.T, root string)
+		expected []events.CollectorEvent
+	}{
+		{
+			name:   "healthy",
+			change: func(t *testing.T, root string) {},
+		},
+		{
+			name: "link down",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_1/1", "state", "1: DOWN")
+				write(t, root, "mlx5_1/1", "phys_state", "3: Disabled")
+			},
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Error,
+				Reason:     ReasonLinkDown,
+				Message:    "port mlx5_1/1 is down, state: 1: DOWN, physical state: 3: Disabled",
+			}},
+		},
+		{
+			name: "physical link down",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_0/1", "phys_state", "2: Polling")
+			},
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Error,
+				Reason:     ReasonLinkDown,
+				Message:    "port mlx5_0/1 is down, state: 4: ACTIVE, physical state: 2: Polling",
+			}},
+		},
+		{
+			name: "port missing",
+			change: func(t *testing.T, root string) {
+				if err := os.RemoveAll(filepath.Join(root, "class", "infiniband", "mlx5_1")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Error,
+				Reason:     ReasonLinkDown,
+			}},
+		},
+		{
+			name: "expected port never seen",
+			opts: Options{ExpectedPorts: []string{"mlx5_2/1"}},
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Error,
+				Reason:     ReasonLinkDown,
+			}},
+		},
+		{
+			name: "rate degraded from the first seen",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_0/1", "rate", "100 Gb/sec (4X EDR)")
+			},
+			expected: []events.CollectorEvent{{
+				TargetType: events.Node,
+				Name:       testNode,
+				EventType:  events.Warning,
+				Reason:     ReasonRateDegraded,
+				Message:    "port mlx5_0/1 rate is 100 Gb/sec (4X EDR), below the expected 200 Gb/sec",
+			}},
+		},
+		{
+			name: "rate below the minimum",
+			opts: Options{MinRate: 400},
+			expected: []events.CollectorEvent{
+				{
+					TargetType: events.Node,
+					Name:       testNode,
+					EventType:  events.Warning,
+					Reason:     ReasonRateDegraded,
+					Message:    "port mlx5_0/1 rate is 200 Gb/sec (4X HDR), below the expected 400 Gb/sec",
+				},
+				{
+					TargetType: events.Node,
+					Name:       testNode,
+					EventType:  events.Warning,
+					Reason:     ReasonRateDegraded,
+					Message:    "port mlx5_1/1 rate is 200 Gb/sec (4X HDR), below the expected 400 Gb/sec",
+				},
+			},
+		},
+		{
+			name: "error counters increased",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_0/1", "counters/symbol_error", "25")
+				write(t, root, "mlx5_1/1", "counters/link_downed", "1")
+			},
+			expected: []events.CollectorEvent{
+				{
+					TargetType: events.Node,
+					Name:       testNode,
+					EventType:  events.Warning,
+					Reason:     ReasonCounterGrowth,
+					Message:    "port mlx5_0/1 counter symbol_error increased by 25 in 1m0s",
+				},
+				{
+					TargetType: events.Node,
+					Name:       testNode,
+					EventType:  events.Warning,
+					Reason:     ReasonCounterGrowth,
+					Message:    "port mlx5_1/1 counter link_downed increased by 1 in 1m0s",
+				},
+			},
+		},
+		{
+			name: "error counters below the thresholds",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_0/1", "counters/symbol_error", "10")
+				write(t, root, "mlx5_0/1", "counters/port_rcv_errors", "13")
+			},
+		},
+		{
+			name: "error counters reset",
+			change: func(t *testing.T, root string) {
+				write(t, root, "mlx5_0/1", "counters/link_downed", "0")
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root := copySysfs(t)
+			opts := c.opts
+			opts.SysfsRoot = root
+			opts.Interval = time.Minute
+			opts.RepeatInterval = time.Hour
+			diag, err := NewInfiniBandDiagnosis(testNode, opts, events.DefaultQueueOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := diag.(*ibDiag)
+
+			now := time.Now()
+			if err := d.check(now); err != nil {
+				t.Fatal(err)
+			}
+			got := drain(d)
+			if c.change != nil {
+				c.change(t, root)
+				if err := d.check(now.Add(time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, drain(d)...)
+			}
+			// the messages of missing ports have the errors of the os
+			for i := range got {
+				if i < len(c.expected) && c.expected[i].Message == "" {
+					got[i].Message = ""
+				}
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expect events %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckRepeatInterval(t *testing.T) {
+	root := copySysfs(t)
+	diag, err := NewInfiniBandDiagnosis(testNode, Options{SysfsRoot: root, Interval: time.Minute, RepeatInterval: 10 * time.Minute}, events.DefaultQueueOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := diag.(*ibDiag)
+
+	now := time.Now()
+	if err := d.check(now); err != nil {
+		t.Fatal(err)
+	}
+	write(t, root, "mlx5_1/1", "state", "1: DOWN")
+	for i, expected := range []int{1, 0, 1} {
+		if err := d.check(now.Add(time.Duration(i*5+1) * time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if got := drain(d); len(got) != expected {
+			t.Errorf("check %d: expect %d events, got %+v", i, expected, got)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package ncclprobe
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/baizeai/kcover/pkg/runner"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*ncclProbe)(nil)
+var _ diagnosis.Diagnostic = (*ncclProbe)(nil)
+
+const (
+	ReasonLowBusBandwidth = "NCCLLowBusBandwidth"
+	ReasonProbeFailed     = "NCCLProbeFailed"
+
+	probeKind = "nccl"
+	nodeIndex = "nodeName"
+	// pollInterval of checking the running probes and starting new ones
+	pollInterval = 30 * time.Second
+)
+
+var probes = metrics.NewCounterVec("kcover_nccl_probes_total",
+	"Number of finished NCCL bandwidth probes by result.", "result")
+
+// busBandwidthPattern matches the summary of nccl-tests, e.g. "# Avg bus bandwidth    : 185.432".
+var busBandwidthPattern = regexp.MustCompile(`(?m)^#\s*Avg bus bandwidth\s*:\s*([0-9.]+)`)
+
+// Baseline is the expected bus bandwidth of the nodes matching the selector. Only the nodes
+// matching a baseline are probed.
+type Baseline struct {
+	Name     string
+	Selector labels.Selector
+	// MinBusBandwidth in GB/s, a lower bandwidth is reported
+	MinBusBandwidth float64
+}
+
+type Options struct {
+	// Namespace of the probe pods
+	Namespace string
+	// Template of the probe pods, which print the output of nccl-tests in the first container.
+	// The pods are bound to the probed nodes and never restarted.
+	Template  corev1.PodTemplateSpec
+	Baselines []Baseline
+	// Interval of probing the same node
+	Interval time.Duration
+	// Timeout of a probe from its creation, including pulling the image
+	Timeout time.Duration
+	// MaxConcurrent probes in the cluster
+	MaxConcurrent int
+}
+
+type probe struct {
+	node     string
+	pod      string
+	baseline Baseline
+	created  time.Time
+}
+
+// ncclProbe runs a short nccl-tests workload on idle nodes, to find the nodes which pass the
+// device checks but are too slow for collective communication.
+type ncclProbe struct {
+	client  kubernetes.Interface
+	opts    Options
+	factory informers.SharedInformerFactory
+	// podFactory only lists the pods of training jobs
+	podFactory informers.SharedInformerFactory
+	nodes      corelisters.NodeLister
+	pods       cache.Indexer
+	events     *events.Queue[events.CollectorEvent]
+	stop       chan struct{}
+
+	// only accessed by the poll loop, they are lost when the leader changes
+	running    map[string]*probe
+	lastProbed map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "ncclprobe"
+
+func init() {
+	diagnosis.Register(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		opts, err := diagnosis.OptionsOf[Options](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewNCCLProbe(ctx.Client, opts, ctx.Watch.Resync, ctx.Queue)
+	})
+}
+
+func NewNCCLProbe(cli kubernetes.Interface, opts Options, resync time.Duration, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	if len(opts.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("the probe pod template has no containers")
+	}
+	if opts.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("max concurrent probes must be positive")
+	}
+	factory := informers.NewSharedInformerFactory(cli, resync)
+	podFactory := informers.NewSharedInformerFactoryWithOptions(cli, resync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = constants.KubeflowJobLabel
+	}))
+	podInformer := podFactory.Core().V1().Pods().Informer()
+	err := podInformer.AddIndexers(cache.Indexers{nodeIndex: func(obj interface{}) ([]string, error) {
+		return []string{obj.(*corev1.Pod).Spec.NodeName}, nil
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &ncclProbe{
+		client:     cli,
+		opts:       opts,
+		factory:    factory,
+		podFactory: podFactory,
+		nodes:      factory.Core().V1().Nodes().Lister(),
+		pods:       podInformer.GetIndexer(),
+		events:     events.NewQueue[events.CollectorEvent]("ncclprobe", queueOpts),
+		stop:       make(chan struct{}),
+		running:    map[string]*probe{},
+		lastProbed: map[string]time.Time{},
+	}, nil
+}
+
+func (d *ncclProbe) Start() error {
+	d.factory.Start(d.stop)
+	d.podFactory.Start(d.stop)
+	go func() {
+		for _, factory := range []informers.SharedInformerFactory{d.factory, d.podFactory} {
+			for typ, synced := range factory.WaitForCacheSync(d.stop) {
+				if !synced {
+					klog.Errorf("sync %v of the nccl probe failed", typ)
+					return
+				}
+			}
+		}
+		d.adopt()
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.poll(time.Now())
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *ncclProbe) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *ncclProbe) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// adopt takes over the probes created by the previous leader.
+func (d *ncclProbe) adopt() {
+	pods, err := d.client.CoreV1().Pods(d.opts.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.Set{constants.ProbeLabel: probeKind}.String(),
+	})
+	if err != nil {
+		klog.Errorf("list nccl probe pods error: %v", err)
+		return
+	}
+	for _, pod := range pods.Items {
+		node, err := d.nodes.Get(pod.Spec.NodeName)
+		baseline, ok := d.baselineOf(node)
+		if err != nil || !ok {
+			d.deletePod(pod.Name)
+			continue
+		}
+		d.running[node.Name] = &probe{node: node.Name, pod: pod.Name, baseline: baseline, created: pod.CreationTimestamp.Time}
+	}
+}
+
+func (d *ncclProbe) baselineOf(node *corev1.Node) (Baseline, bool) {
+	if node == nil {
+		return Baseline{}, false
+	}
+	for _, b := range d.opts.Baselines {
+		if b.Selector.Matches(labels.Set(node.Labels)) {
+			return b, true
+		}
+	}
+	return Baseline{}, false
+}
+
+// idle returns whether no training pods are running on the node.
+func (d *ncclProbe) idle(node string) bool {
+	objs, err := d.pods.ByIndex(nodeIndex, node)
+	if err != nil {
+		return false
+	}
+	for _, obj := range objs {
+		pod := obj.(*corev1.Pod)
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func available(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, t := range node.Spec.Taints {
+		if t.Key == constants.UnhealthyTaintKey {
+			return false
+		}
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (d *ncclProbe) poll(now time.Time) {
+	for name, p := range d.running {
+		if d.checkProbe(p, now) {
+			delete(d.running, name)
+			d.lastProbed[name] = now
+		}
+	}
+	if len(d.running) >= d.opts.MaxConcurrent {
+		return
+	}
+
+	nodes, err := d.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list nodes error: %v", err)
+		return
+	}
+	// the nodes not probed for the longest time first
+	sort.Slice(nodes, func(i, j int) bool {
+		return d.lastProbed[nodes[i].Name].Before(d.lastProbed[nodes[j].Name])
+	})
+	for _, node := range nodes {
+		if len(d.running) >= d.opts.MaxConcurrent {
+			return
+		}
+		if _, ok := d.running[node.Name]; ok || now.Sub(d.lastProbed[node.Name]) < d.opts.Interval {
+			continue
+		}
+		baseline, ok := d.baselineOf(node)
+		if !ok || !available(node) || !d.idle(node.Name) {
+			continue
+		}
+		p, err := d.createProbe(node.Name, baseline, now)
+		if err != nil {
+			klog.Errorf("create nccl probe on node %s error: %v", node.Name, err)
+			continue
+		}
+		klog.Infof("nccl probe %s started on node %s", p.pod, node.Name)
+		d.running[node.Name] = p
+	}
+}
+
+func (d *ncclProbe) createProbe(node string, baseline Baseline, now time.Time) (*probe, error) {
+	tmpl := d.opts.Template.DeepCopy()
+	pod := &corev1.Pod{
+		ObjectMeta: tmpl.ObjectMeta,
+		Spec:       tmpl.Spec,
+	}
+	pod.Name = ""
+	pod.GenerateName = "kcover-nccl-probe-"
+	pod.Namespace = d.opts.Namespace
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[constants.ProbeLabel] = probeKind
+	pod.Spec.NodeName = node
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	deadline := int64(d.opts.Timeout.Seconds())
+	pod.Spec.ActiveDeadlineSeconds = &deadline
+	created, err := d.client.CoreV1().Pods(d.opts.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &probe{node: node, pod: created.Name, baseline: baseline, created: now}, nil
+}
+
+// checkProbe handles the result of the probe, it returns true if the probe is finished.
+func (d *ncclProbe) checkProbe(p *probe, now time.Time) bool {
+	pod, err := d.client.CoreV1().Pods(d.opts.Namespace).Get(context.Background(), p.pod, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		probes.WithLabelValues("deleted").Inc()
+		return true
+	}
+	if err != nil {
+		klog.Errorf("get nccl probe %s error: %v", p.pod, err)
+		return false
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		d.checkBandwidth(p, pod)
+	case corev1.PodFailed:
+		// the deadline of a probe which can not start is not a fault of the node
+		if pod.Status.Reason == "DeadlineExceeded" && pod.Status.StartTime == nil {
+			probes.WithLabelValues("timeout").Inc()
+			klog.Warningf("nccl probe %s on node %s did not start in %v", p.pod, p.node, d.opts.Timeout)
+			break
+		}
+		probes.WithLabelValues("failed").Inc()
+		d.report(p.node, ReasonProbeFailed, fmt.Sprintf("nccl probe %s failed: %s %s", p.pod, pod.Status.Reason, pod.Status.Message))
+	default:
+		if !d.idle(p.node) {
+			probes.WithLabelValues("aborted").Inc()
+			klog.Infof("abort nccl probe %s, training pods are scheduled to node %s", p.pod, p.node)
+			break
+		}
+		if now.Sub(p.created) > d.opts.Timeout+pollInterval {
+			probes.WithLabelValues("timeout").Inc()
+			klog.Warningf("nccl probe %s on node %s is still %s after %v", p.pod, p.node, pod.Status.Phase, d.opts.Timeout)
+			break
+		}
+		return false
+	}
+	d.deletePod(p.pod)
+	return true
+}
+
+func (d *ncclProbe) checkBandwidth(p *probe, pod *corev1.Pod) {
+	logs, err := d.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: pod.Spec.Containers[0].Name,
+	}).DoRaw(context.Background())
+	if err != nil {
+		probes.WithLabelValues("failed").Inc()
+		klog.Errorf("get logs of nccl probe %s error: %v", pod.Name, err)
+		return
+	}
+	bw, err := ParseBusBandwidth(logs)
+	if err != nil {
+		probes.WithLabelValues("failed").Inc()
+		klog.Errorf("nccl probe %s: %v", pod.Name, err)
+		return
+	}
+	klog.Infof("nccl probe %s measured %.2f GB/s on node %s, baseline %s is %g GB/s", pod.Name, bw, p.node, p.baseline.Name, p.baseline.MinBusBandwidth)
+	if bw >= p.baseline.MinBusBandwidth {
+		probes.WithLabelValues("passed").Inc()
+		return
+	}
+	probes.WithLabelValues("low").Inc()
+	d.report(p.node, ReasonLowBusBandwidth, fmt.Sprintf("nccl probe measured bus bandwidth %.2f GB/s, below %g GB/s of baseline %s",
+		bw, p.baseline.MinBusBandwidth, p.baseline.Name))
+}
+
+// ParseBusBandwidth returns the average bus bandwidth in GB/s printed by nccl-tests.
+func ParseBusBandwidth(output []byte) (float64, error) {
+	m := busBandwidthPattern.FindSubmatch(output)
+	if m == nil {
+		return 0, fmt.Errorf("no average bus bandwidth in the output")
+	}
+	return strconv.ParseFloat(string(m[1]), 64)
+}
+
+func (d *ncclProbe) deletePod(name string) {
+	err := d.client.CoreV1().Pods(d.opts.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("delete nccl probe %s error: %v", name, err)
+	}
+}
+
+func (d *ncclProbe) report(node, reason, message string) {
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       node,
+		EventType:  events.Warning,
+		Reason:     reason,
+		Message:    message,
+	})
+}
@@ -0,0 +1,226 @@
+package npd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*npdCollector)(nil)
+var _ diagnosis.Diagnostic = (*npdCollector)(nil)
+
+type Options struct {
+	// Conditions maps the node condition types, which are True when the problem exists, to event types
+	Conditions map[string]events.EventType
+	// Events maps "<source component>/<reason>" of node events to event types
+	Events map[string]events.EventType
+}
+
+var DefaultOptions = Options{
+	Conditions: map[string]events.EventType{
+		"KernelDeadlock":     events.Error,
+		"ReadonlyFilesystem": events.Error,
+	},
+	Events: map[string]events.EventType{
+		"kernel-monitor/KernelOops":     events.Error,
+		"kernel-monitor/TaskHung":       events.Warning,
+		"kernel-monitor/Ext4Error":      events.Error,
+		"kernel-monitor/AUFSUmountHung": events.Warning,
+	},
+}
+
+// ParseRules parses rules in the form of "key=Error,key=Warning".
+func ParseRules(s string) (map[string]events.EventType, error) {
+	rules := map[string]events.EventType{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, typ, ok := strings.Cut(item, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid rule %q, expect key=Error or key=Warning", item)
+		}
+		switch typ {
+		case events.Error.String():
+			rules[key] = events.Error
+		case events.Warning.String():
+			rules[key] = events.Warning
+		default:
+			return nil, fmt.Errorf("invalid event type %q of rule %q", typ, item)
+		}
+	}
+	return rules, nil
+}
+
+// FormatRules is the reverse of ParseRules.
+func FormatRules(rules map[string]events.EventType) string {
+	items := make([]string, 0, len(rules))
+	for k, v := range rules {
+		items = append(items, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(items, ",")
+}
+
+// npdCollector reuses the problems detected by node-problem-detector, from its node conditions and events.
+type npdCollector struct {
+	client     kubernetes.Interface
+	mu         sync.RWMutex
+	opts       Options
+	watchOpts  events.WatchOptions
+	eventsChan *events.Queue[events.CollectorEvent]
+	stop       chan struct{}
+}
+
+// Name of the diagnostic in the registry.
+const Name = "npd"
+
+func init() {
+	diagnosis.Register(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		opts := DefaultOptions
+		if ctx.Options != nil {
+			var err error
+			if opts, err = diagnosis.OptionsOf[Options](ctx); err != nil {
+				return nil, err
+			}
+		}
+		return NewNPDCollector(ctx.Client, opts, ctx.Watch, ctx.Queue)
+	})
+}
+
+func NewNPDCollector(cli kubernetes.Interface, opts Options, watchOpts events.WatchOptions, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	return &npdCollector{
+		client:     cli,
+		opts:       opts,
+		watchOpts:  watchOpts,
+		eventsChan: events.NewQueue[events.CollectorEvent]("npd", queueOpts),
+		stop:       make(chan struct{}),
+	}, nil
+}
+
+// SetOptions replaces the rules, the rules of a kind which had none at start only apply after a restart.
+func (n *npdCollector) SetOptions(opts Options) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.opts = opts
+}
+
+func (n *npdCollector) getOptions() Options {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.opts
+}
+
+func conditionStatus(node *corev1.Node, typ string) (corev1.NodeCondition, bool) {
+	if node == nil {
+		return corev1.NodeCondition{}, false
+	}
+	for _, c := range node.Status.Conditions {
+		if string(c.Type) == typ {
+			return c, true
+		}
+	}
+	return corev1.NodeCondition{}, false
+}
+
+func (n *npdCollector) onNodeUpdate(oldNode, newNode *corev1.Node) {
+	for typ, eventType := range n.getOptions().Conditions {
+		cond, ok := conditionStatus(newNode, typ)
+		if !ok || cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if oldCond, ok := conditionStatus(oldNode, typ); ok && oldCond.Status == corev1.ConditionTrue {
+			continue
+		}
+		if cond.LastTransitionTime.Add(n.watchOpts.MaxEventAge).Before(time.Now()) {
+			klog.V(4).Infof("condition %s of node %s is too old, ignore it", typ, newNode.Name)
+			continue
+		}
+		n.eventsChan.Push(events.CollectorEvent{
+			TargetType: events.Node,
+			Name:       newNode.Name,
+			EventType:  eventType,
+			Reason:     cond.Reason,
+			Message:    fmt.Sprintf("node condition %s is True: %s", typ, cond.Message),
+		})
+	}
+}
+
+func (n *npdCollector) onEvent(event *corev1.Event) {
+	if event.InvolvedObject.Kind != "Node" {
+		return
+	}
+	eventType, ok := n.getOptions().Events[event.Source.Component+"/"+event.Reason]
+	if !ok {
+		return
+	}
+	eventTimestamp := event.LastTimestamp
+	if eventTimestamp.IsZero() {
+		eventTimestamp = event.CreationTimestamp
+	}
+	if eventTimestamp.Add(n.watchOpts.MaxEventAge).Before(time.Now()) {
+		return
+	}
+	n.eventsChan.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       event.InvolvedObject.Name,
+		EventType:  eventType,
+		Reason:     event.Reason,
+		Message:    fmt.Sprintf("%s reported %s: %s", event.Source.Component, event.Reason, event.Message),
+	})
+}
+
+func (n *npdCollector) Start() error {
+	factory := informers.NewSharedInformerFactory(n.client, n.watchOpts.Resync)
+	if len(n.opts.Conditions) > 0 {
+		_, err := factory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				n.onNodeUpdate(nil, obj.(*corev1.Node))
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				n.onNodeUpdate(oldObj.(*corev1.Node), newObj.(*corev1.Node))
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(n.opts.Events) > 0 {
+		onEvent := func(obj interface{}) {
+			n.onEvent(obj.(*corev1.Event))
+		}
+		_, err := factory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: onEvent,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// repeated events only bump the count
+				if oldObj.(*corev1.Event).Count != newObj.(*corev1.Event).Count {
+					onEvent(newObj)
+				}
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	factory.Start(n.stop)
+	return nil
+}
+
+func (n *npdCollector) Stop() {
+	close(n.stop)
+	n.eventsChan.Close()
+}
+
+func (n *npdCollector) Events() <-chan events.CollectorEvent {
+	return n.eventsChan.C()
+}
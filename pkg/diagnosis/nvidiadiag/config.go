@@ -0,0 +1,90 @@
+package nvidiadiag
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	_ diagnosis.AgentOptions = (*DCGMConfig)(nil)
+	_ diagnosis.AgentOptions = (*ExporterConfig)(nil)
+)
+
+// DCGMConfig is the dcgm section of the configuration of the agent.
+type DCGMConfig struct {
+	Enabled  bool            `json:"enabled"`
+	Interval metav1.Duration `json:"interval"`
+}
+
+func NewDCGMConfig() *DCGMConfig {
+	return &DCGMConfig{Enabled: true, Interval: metav1.Duration{Duration: 30 * time.Second}}
+}
+
+func (c *DCGMConfig) IsEnabled() bool {
+	return c.Enabled
+}
+
+func (c *DCGMConfig) Validate(path *field.Path) field.ErrorList {
+	return config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+}
+
+func (c *DCGMConfig) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Enabled, "dcgm", c.Enabled, "run the dcgm diagnostic")
+	fs.DurationVar(&c.Interval.Duration, "dcgm-interval", c.Interval.Duration, "interval of the dcgm diagnostic")
+}
+
+// ExporterConfig is the dcgm-exporter section of the configuration of the agent.
+type ExporterConfig struct {
+	// URL of the metrics of the dcgm-exporter on this node, empty disables the threshold rules
+	URL            string          `json:"url,omitempty"`
+	Interval       metav1.Duration `json:"interval"`
+	RepeatInterval metav1.Duration `json:"repeatInterval"`
+	Rules          []ThresholdRule `json:"rules,omitempty"`
+}
+
+func NewExporterConfig() *ExporterConfig {
+	return &ExporterConfig{
+		Interval:       metav1.Duration{Duration: 30 * time.Second},
+		RepeatInterval: metav1.Duration{Duration: 10 * time.Minute},
+	}
+}
+
+// SetDefaults sets the rules if the file has none.
+func (c *ExporterConfig) SetDefaults() {
+	if len(c.Rules) == 0 {
+		c.Rules = DefaultThresholdRules
+	}
+}
+
+func (c *ExporterConfig) IsEnabled() bool {
+	return c.URL != ""
+}
+
+func (c *ExporterConfig) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c.URL == "" {
+		errs = append(errs, field.Required(path.Child("url"), "required to enable "+ExporterName))
+	}
+	errs = config.ValidatePositive(errs, path.Child("interval"), c.Interval)
+	return config.ValidatePositive(errs, path.Child("repeatInterval"), c.RepeatInterval)
+}
+
+func (c *ExporterConfig) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "dcgm-exporter-url", c.URL, "metrics url of the dcgm-exporter on this node, empty to disable the threshold rules")
+	fs.DurationVar(&c.Interval.Duration, "dcgm-exporter-interval", c.Interval.Duration, "interval of scraping dcgm-exporter")
+	fs.DurationVar(&c.RepeatInterval.Duration, "dcgm-exporter-repeat-interval", c.RepeatInterval.Duration, "interval of reporting a rule which is still firing for the same GPU")
+}
+
+func (c *ExporterConfig) Options() ExporterOptions {
+	return ExporterOptions{
+		URL:            c.URL,
+		Interval:       c.Interval.Duration,
+		Rules:          c.Rules,
+		RepeatInterval: c.RepeatInterval.Duration,
+	}
+}
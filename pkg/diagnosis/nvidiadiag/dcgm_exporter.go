@@ -0,0 +1,200 @@
+package nvidiadiag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*dcgmExporterDiag)(nil)
+var _ diagnosis.Diagnostic = (*dcgmExporterDiag)(nil)
+
+// ThresholdRule fires when the value of the metric of a GPU is above the threshold.
+type ThresholdRule struct {
+	// Reason of the events, e.g. DoubleBitECCErrors
+	Reason string `json:"reason"`
+	Metric string `json:"metric"`
+	// Rate compares the per second increase between two scrapes instead of the value
+	Rate       bool              `json:"rate,omitempty"`
+	Threshold  float64           `json:"threshold"`
+	EventType  events.EventType  `json:"eventType"`
+	TargetType events.TargetType `json:"targetType"`
+}
+
+// DefaultThresholdRules use the fields exported by the default dcgm-exporter counters.
+var DefaultThresholdRules = []ThresholdRule{
+	{Reason: "DoubleBitECCErrors", Metric: "DCGM_FI_DEV_ECC_DBE_VOL_TOTAL", Threshold: 0, EventType: events.Error, TargetType: events.Device},
+	{Reason: "RetiredPagesPending", Metric: "DCGM_FI_DEV_RETIRED_PENDING", Threshold: 0, EventType: events.Warning, TargetType: events.Device},
+	{Reason: "RowRemapFailure", Metric: "DCGM_FI_DEV_ROW_REMAP_FAILURE", Threshold: 0, EventType: events.Error, TargetType: events.Device},
+	{Reason: "NVLinkCRCErrors", Metric: "DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL", Rate: true, Threshold: 100, EventType: events.Warning, TargetType: events.Device},
+	// violation counters are in microseconds, so 100000 per second means throttled 10% of the time
+	{Reason: "ThermalViolation", Metric: "DCGM_FI_DEV_THERMAL_VIOLATION", Rate: true, Threshold: 100000, EventType: events.Warning, TargetType: events.Device},
+	{Reason: "PowerThrottling", Metric: "DCGM_FI_DEV_POWER_VIOLATION", Rate: true, Threshold: 100000, EventType: events.Warning, TargetType: events.Device},
+}
+
+type ExporterOptions struct {
+	// URL of the metrics endpoint of dcgm-exporter on this node
+	URL      string
+	Interval time.Duration
+	Rules    []ThresholdRule
+	// RepeatInterval is how often a rule still firing for the same GPU is reported again
+	RepeatInterval time.Duration
+}
+
+type counterSample struct {
+	value float64
+	time  time.Time
+}
+
+type dcgmExporterDiag struct {
+	nodeName string
+	opts     ExporterOptions
+	client   *http.Client
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	// only accessed by the scrape loop
+	previous map[string]counterSample
+	fired    map[string]time.Time
+}
+
+// ExporterName of the diagnostic in the registry.
+const ExporterName = "dcgm-exporter"
+
+func init() {
+	diagnosis.RegisterAgent(ExporterName, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*ExporterConfig](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewDCGMExporterDiagnosis(ctx.NodeName, conf.Options(), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewExporterConfig()
+	})
+}
+
+func NewDCGMExporterDiagnosis(nodeName string, opts ExporterOptions, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("dcgm-exporter url can not be empty")
+	}
+	return &dcgmExporterDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		events:   events.NewQueue[events.CollectorEvent]("dcgm-exporter", queueOpts),
+		stop:     make(chan struct{}),
+		previous: map[string]counterSample{},
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *dcgmExporterDiag) Start() error {
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := d.scrape(); err != nil {
+					klog.Errorf("scrape dcgm-exporter %s error: %v", d.opts.URL, err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *dcgmExporterDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *dcgmExporterDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// gpuOf returns the identity of the GPU of the sample, the UUID is preferred over the index.
+func gpuOf(s metrics.Sample) string {
+	if uuid := s.Labels["UUID"]; uuid != "" {
+		return uuid
+	}
+	return s.Labels["gpu"]
+}
+
+func (d *dcgmExporterDiag) scrape() error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.opts.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	samples, err := metrics.ParseText(resp.Body)
+	if err != nil {
+		return err
+	}
+	d.evaluate(samples, time.Now())
+	return nil
+}
+
+func (d *dcgmExporterDiag) evaluate(samples []metrics.Sample, now time.Time) {
+	for _, rule := range d.opts.Rules {
+		for _, s := range samples {
+			if s.Name != rule.Metric {
+				continue
+			}
+			gpu := gpuOf(s)
+			value := s.Value
+			if rule.Rate {
+				key := rule.Metric + "/" + gpu
+				prev, ok := d.previous[key]
+				d.previous[key] = counterSample{value: s.Value, time: now}
+				if !ok || !now.After(prev.time) || s.Value < prev.value {
+					// first scrape or counter reset
+					continue
+				}
+				value = (s.Value - prev.value) / now.Sub(prev.time).Seconds()
+			}
+			if value <= rule.Threshold {
+				continue
+			}
+			firedKey := rule.Reason + "/" + gpu
+			if t, ok := d.fired[firedKey]; ok && now.Sub(t) < d.opts.RepeatInterval {
+				continue
+			}
+			d.fired[firedKey] = now
+
+			unit := ""
+			if rule.Rate {
+				unit = "/s"
+			}
+			e := events.CollectorEvent{
+				TargetType: rule.TargetType,
+				Name:       d.nodeName,
+				EventType:  rule.EventType,
+				Reason:     rule.Reason,
+				Message:    fmt.Sprintf("GPU %s %s is %g%s, above the threshold %g%s", gpu, rule.Metric, value, unit, rule.Threshold, unit),
+			}
+			if e.TargetType == events.Device {
+				e.Device = gpu
+			}
+			d.events.Push(e)
+		}
+	}
+}
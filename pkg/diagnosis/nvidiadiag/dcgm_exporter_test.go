@@ -0,0 +1,162 @@
+package nvidiadiag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/metrics"
+)
+
+const (
+	testNode = "worker-a800-2"
+	gpu0     = "GPU-0a1b2c3d-0000-4000-8000-000000000000"
+	gpu1     = "GPU-0a1b2c3d-0000-4000-8000-000000000001"
+)
+
+func newTestExporterDiag(t *testing.T, url string) *dcgmExporterDiag {
+	t.Helper()
+	d, err := NewDCGMExporterDiagnosis(testNode, ExporterOptions{
+		URL:            url,
+		Interval:       time.Minute,
+		Rules:          DefaultThresholdRules,
+		RepeatInterval: time.Hour,
+	}, events.DefaultQueueOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*dcgmExporterDiag)
+}
+
+func drain(d *dcgmExporterDiag) []events.CollectorEvent {
+	var res []events.CollectorEvent
+	for {
+		select {
+		case e := <-d.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+func readFixture(t *testing.T) string {
+	t.Helper()
+	bs, err := os.ReadFile("testdata/dcgm-exporter.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestScrapeThresholdRules(t *testing.T) {
+	fixture := readFixture(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(fixture))
+	}))
+	defer srv.Close()
+	d := newTestExporterDiag(t, srv.URL)
+
+	if err := d.scrape(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []events.CollectorEvent{
+		{
+			TargetType: events.Device,
+			Name:       testNode,
+			Device:     gpu1,
+			EventType:  events.Error,
+			Reason:     "DoubleBitECCErrors",
+			Message:    "GPU " + gpu1 + " DCGM_FI_DEV_ECC_DBE_VOL_TOTAL is 2, above the threshold 0",
+		},
+		{
+			TargetType: events.Device,
+			Name:       testNode,
+			Device:     gpu0,
+			EventType:  events.Warning,
+			Reason:     "RetiredPagesPending",
+			Message:    "GPU " + gpu0 + " DCGM_FI_DEV_RETIRED_PENDING is 1, above the threshold 0",
+		},
+	}
+	if got := drain(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect events %+v, got %+v", expected, got)
+	}
+
+	// the firing rules are not reported again within the repeat interval, and the unchanged
+	// counters have no rate
+	if err := d.scrape(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(d); len(got) != 0 {
+		t.Errorf("expect no events, got %+v", got)
+	}
+}
+
+func TestScrapeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "dcgm is not ready", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	d := newTestExporterDiag(t, srv.URL)
+
+	if err := d.scrape(); err == nil {
+		t.Error("expect error of the unexpected status")
+	}
+	if got := drain(d); len(got) != 0 {
+		t.Errorf("expect no events, got %+v", got)
+	}
+}
+
+func TestRateRules(t *testing.T) {
+	fixture := readFixture(t)
+	parse := func(text string) []metrics.Sample {
+		samples, err := metrics.ParseText(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return samples
+	}
+	now := time.Now()
+	d := newTestExporterDiag(t, "http://localhost:9400/metrics")
+	d.evaluate(parse(fixture), now)
+	drain(d)
+
+	// 1200 NVLink CRC errors of GPU 0 and 2s of thermal throttling of GPU 1 in 10s
+	next := strings.Replace(fixture,
+		`DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL{gpu="0",UUID="`+gpu0+`",device="nvidia0",modelName="NVIDIA A800-SXM4-80GB",Hostname="worker-a800-2"} 12`,
+		`DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL{gpu="0",UUID="`+gpu0+`",device="nvidia0",modelName="NVIDIA A800-SXM4-80GB",Hostname="worker-a800-2"} 1212`, 1)
+	next = strings.Replace(next,
+		`DCGM_FI_DEV_THERMAL_VIOLATION{gpu="1",UUID="`+gpu1+`",device="nvidia1",modelName="NVIDIA A800-SXM4-80GB",Hostname="worker-a800-2"} 0`,
+		`DCGM_FI_DEV_THERMAL_VIOLATION{gpu="1",UUID="`+gpu1+`",device="nvidia1",modelName="NVIDIA A800-SXM4-80GB",Hostname="worker-a800-2"} 2e+06`, 1)
+	if next == fixture {
+		t.Fatal("fixture has changed, update the test")
+	}
+	d.evaluate(parse(next), now.Add(10*time.Second))
+	expected := []events.CollectorEvent{
+		{
+			TargetType: events.Device,
+			Name:       testNode,
+			Device:     gpu0,
+			EventType:  events.Warning,
+			Reason:     "NVLinkCRCErrors",
+			Message:    "GPU " + gpu0 + " DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL is 120/s, above the threshold 100/s",
+		},
+		{
+			TargetType: events.Device,
+			Name:       testNode,
+			Device:     gpu1,
+			EventType:  events.Warning,
+			Reason:     "ThermalViolation",
+			Message:    "GPU " + gpu1 + " DCGM_FI_DEV_THERMAL_VIOLATION is 200000/s, above the threshold 100000/s",
+		},
+	}
+	if got := drain(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect events %+v, got %+v", expected, got)
+	}
+}
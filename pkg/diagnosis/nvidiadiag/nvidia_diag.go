@@ -14,13 +14,30 @@ var _ diagnosis.Diagnostic = (*dcgmDiag)(nil)
 
 type dcgmDiag struct {
 	nodeName string
-	events   chan events.CollectorEvent
+	interval time.Duration
+	events   *events.Queue[events.CollectorEvent]
 	stop     chan struct{}
 }
 
-func NewDCGMDiagnosis(nodeName string) (diagnosis.Diagnostic, error) {
+// DCGMName of the diagnostic in the registry.
+const DCGMName = "dcgm"
+
+func init() {
+	diagnosis.RegisterAgent(DCGMName, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*DCGMConfig](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewDCGMDiagnosis(ctx.NodeName, conf.Interval.Duration, ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewDCGMConfig()
+	})
+}
+
+func NewDCGMDiagnosis(nodeName string, interval time.Duration, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
 	return &dcgmDiag{
-		events:   make(chan events.CollectorEvent),
+		interval: interval,
+		events:   events.NewQueue[events.CollectorEvent]("dcgm", queueOpts),
 		stop:     make(chan struct{}),
 		nodeName: nodeName,
 	}, nil
@@ -28,7 +45,7 @@ func NewDCGMDiagnosis(nodeName string) (diagnosis.Diagnostic, error) {
 
 func (d *dcgmDiag) Start() error {
 	go func() {
-		t := time.NewTicker(time.Second * 30)
+		t := time.NewTicker(d.interval)
 		defer t.Stop()
 		for {
 			select {
@@ -52,8 +69,9 @@ func (d *dcgmDiag) Start() error {
 
 func (d *dcgmDiag) Stop() {
 	close(d.stop)
+	d.events.Close()
 }
 
 func (d *dcgmDiag) Events() <-chan events.CollectorEvent {
-	return d.events
+	return d.events.C()
 }
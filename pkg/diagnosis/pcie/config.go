@@ -0,0 +1,56 @@
+package pcie
+
+import (
+	"flag"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the pcie section of the configuration of the agent.
+type Config struct {
+	Enabled                 bool              `json:"enabled"`
+	Interval                metav1.Duration   `json:"interval"`
+	MaxCorrectablePerMinute float64           `json:"maxCorrectablePerMinute"`
+	SpeedCheckVendors       config.StringList `json:"speedCheckVendors,omitempty"`
+}
+
+func NewConfig() *Config {
+	return &Config{Enabled: true, Interval: metav1.Duration{Duration: time.Minute}, MaxCorrectablePerMinute: 100}
+}
+
+// SetDefaults sets the vendors if neither the file nor the flags did.
+func (c *Config) SetDefaults() {
+	if c.SpeedCheckVendors == nil {
+		c.SpeedCheckVendors = DefaultSpeedCheckVendors
+	}
+}
+
+func (c *Config) IsEnabled() bool {
+	return c.Enabled
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	return config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+}
+
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Enabled, "pcie", c.Enabled, "check the pcie link and AER errors of NVIDIA and Mellanox devices")
+	fs.DurationVar(&c.Interval.Duration, "pcie-interval", c.Interval.Duration, "interval of checking pcie devices")
+	fs.Float64Var(&c.MaxCorrectablePerMinute, "pcie-max-correctable-per-minute", c.MaxCorrectablePerMinute, "maximum increase per minute of correctable AER errors of a device")
+}
+
+func (c *Config) Options(ctx diagnosis.Context) Options {
+	return Options{
+		SysfsRoot:               ctx.SysfsRoot,
+		Interval:                c.Interval.Duration,
+		SpeedCheckVendors:       c.SpeedCheckVendors,
+		MaxCorrectablePerMinute: c.MaxCorrectablePerMinute,
+		RepeatInterval:          ctx.RepeatInterval,
+	}
+}
@@ -0,0 +1,245 @@
+package pcie
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*pcieDiag)(nil)
+var _ diagnosis.Diagnostic = (*pcieDiag)(nil)
+
+const (
+	ReasonLinkWidthDegraded = "PCIeLinkWidthDegraded"
+	ReasonLinkSpeedDegraded = "PCIeLinkSpeedDegraded"
+	ReasonCorrectableErrors = "PCIeCorrectableErrors"
+	ReasonNonFatalErrors    = "PCIeNonFatalErrors"
+	ReasonFatalErrors       = "PCIeFatalErrors"
+
+	VendorNVIDIA   = "0x10de"
+	VendorMellanox = "0x15b3"
+)
+
+type Options struct {
+	// SysfsRoot is the mount point of sysfs, tests may point it to a fake tree
+	SysfsRoot string
+	Interval  time.Duration
+	Vendors   []string
+	// SpeedCheckVendors are the vendors whose link speed is checked, NVIDIA GPUs lower the
+	// link speed when they are idle so they are not checked by default
+	SpeedCheckVendors []string
+	// MaxCorrectablePerMinute is the maximum increase per minute of correctable AER errors
+	MaxCorrectablePerMinute float64
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+var (
+	DefaultVendors           = []string{VendorNVIDIA, VendorMellanox}
+	DefaultSpeedCheckVendors = []string{VendorMellanox}
+)
+
+type aerCounters struct {
+	correctable, nonFatal, fatal uint64
+	time                         time.Time
+}
+
+type pcieDiag struct {
+	nodeName string
+	opts     Options
+	vendors  sets.Set[string]
+	speed    sets.Set[string]
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	// only accessed by the check loop
+	aer   map[string]aerCounters
+	fired map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "pcie"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewPCIeDiagnosis(ctx.NodeName, conf.Options(ctx), ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewConfig()
+	})
+}
+
+func NewPCIeDiagnosis(nodeName string, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	if len(opts.Vendors) == 0 {
+		opts.Vendors = DefaultVendors
+	}
+	return &pcieDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		vendors:  sets.New(opts.Vendors...),
+		speed:    sets.New(opts.SpeedCheckVendors...),
+		events:   events.NewQueue[events.CollectorEvent]("pcie", queueOpts),
+		stop:     make(chan struct{}),
+		aer:      map[string]aerCounters{},
+		fired:    map[string]time.Time{},
+	}, nil
+}
+
+func (d *pcieDiag) Start() error {
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := d.check(time.Now()); err != nil {
+					klog.Errorf("check pcie devices error: %v", err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *pcieDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *pcieDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+func readString(path string) (string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// parseSpeed parses link speeds like "16.0 GT/s PCIe" or "8 GT/s".
+func parseSpeed(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty link speed")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// parseAERTotal returns the TOTAL_ERR_* value of the aer_dev_* files.
+func parseAERTotal(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.HasPrefix(fields[0], "TOTAL_ERR_") {
+			v, err := strconv.ParseUint(fields[1], 10, 64)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+func (d *pcieDiag) check(now time.Time) error {
+	dirs, err := filepath.Glob(filepath.Join(d.opts.SysfsRoot, "bus", "pci", "devices", "*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		vendor, err := readString(filepath.Join(dir, "vendor"))
+		if err != nil || !d.vendors.Has(vendor) {
+			continue
+		}
+		d.checkDevice(filepath.Base(dir), vendor, dir, now)
+	}
+	return nil
+}
+
+func (d *pcieDiag) checkDevice(bdf, vendor, dir string, now time.Time) {
+	curWidth, err1 := readString(filepath.Join(dir, "current_link_width"))
+	maxWidth, err2 := readString(filepath.Join(dir, "max_link_width"))
+	if err1 == nil && err2 == nil {
+		cur, err1 := strconv.Atoi(curWidth)
+		max, err2 := strconv.Atoi(maxWidth)
+		// bridges report 0 when there is no link
+		if err1 == nil && err2 == nil && cur > 0 && cur < max {
+			d.report(bdf, ReasonLinkWidthDegraded, events.Warning, fmt.Sprintf("device %s link width is x%d, below the max x%d", bdf, cur, max), now)
+		}
+	}
+
+	if d.speed.Has(vendor) {
+		curSpeed, err1 := readString(filepath.Join(dir, "current_link_speed"))
+		maxSpeed, err2 := readString(filepath.Join(dir, "max_link_speed"))
+		if err1 == nil && err2 == nil {
+			cur, err1 := parseSpeed(curSpeed)
+			max, err2 := parseSpeed(maxSpeed)
+			if err1 == nil && err2 == nil && cur > 0 && cur < max {
+				d.report(bdf, ReasonLinkSpeedDegraded, events.Warning, fmt.Sprintf("device %s link speed is %s, below the max %s", bdf, curSpeed, maxSpeed), now)
+			}
+		}
+	}
+
+	var cur aerCounters
+	var ok1, ok2, ok3 bool
+	cur.correctable, ok1 = parseAERTotal(filepath.Join(dir, "aer_dev_correctable"))
+	cur.nonFatal, ok2 = parseAERTotal(filepath.Join(dir, "aer_dev_nonfatal"))
+	cur.fatal, ok3 = parseAERTotal(filepath.Join(dir, "aer_dev_fatal"))
+	if !ok1 && !ok2 && !ok3 {
+		return
+	}
+	cur.time = now
+	prev, ok := d.aer[bdf]
+	d.aer[bdf] = cur
+	if !ok || !now.After(prev.time) {
+		return
+	}
+	if ok3 && cur.fatal > prev.fatal {
+		d.report(bdf, ReasonFatalErrors, events.Error, fmt.Sprintf("device %s reported %d fatal AER errors", bdf, cur.fatal-prev.fatal), now)
+	}
+	if ok2 && cur.nonFatal > prev.nonFatal {
+		d.report(bdf, ReasonNonFatalErrors, events.Warning, fmt.Sprintf("device %s reported %d non-fatal AER errors", bdf, cur.nonFatal-prev.nonFatal), now)
+	}
+	if ok1 && cur.correctable > prev.correctable {
+		elapsed := now.Sub(prev.time)
+		if perMinute := float64(cur.correctable-prev.correctable) / elapsed.Minutes(); perMinute > d.opts.MaxCorrectablePerMinute {
+			d.report(bdf, ReasonCorrectableErrors, events.Warning,
+				fmt.Sprintf("device %s reported %d correctable AER errors in %v", bdf, cur.correctable-prev.correctable, elapsed.Round(time.Second)), now)
+		}
+	}
+}
+
+func (d *pcieDiag) report(bdf, reason string, eventType events.EventType, message string, now time.Time) {
+	key := reason + "/" + bdf
+	if t, ok := d.fired[key]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		return
+	}
+	d.fired[key] = now
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Device,
+		Name:       d.nodeName,
+		Device:     bdf,
+		EventType:  eventType,
+		Reason:     reason,
+		Message:    message,
+	})
+}
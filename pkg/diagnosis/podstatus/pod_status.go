@@ -10,6 +10,7 @@ import (
 	"github.com/baizeai/kcover/pkg/events"
 	"github.com/baizeai/kcover/pkg/runner"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -18,23 +19,130 @@ import (
 var _ runner.Runner = (*podStatusCollector)(nil)
 var _ diagnosis.Diagnostic = (*podStatusCollector)(nil)
 
+const (
+	nodePullFailureWindow    = 10 * time.Minute
+	nodePullFailureThreshold = 3
+)
+
+var (
+	waitingFailureReasons = sets.New(
+		events.ReasonErrImagePull,
+		events.ReasonImagePullBackOff,
+		events.ReasonCreateContainerConfigError,
+		events.ReasonRunContainerError,
+	)
+	imagePullFailureReasons = sets.New(
+		events.ReasonErrImagePull,
+		events.ReasonImagePullBackOff,
+	)
+)
+
 type podStatusCollector struct {
 	client     kubernetes.Interface
-	eventsChan chan events.CollectorEvent
+	eventsChan *events.Queue[events.CollectorEvent]
 	stop       chan struct{}
+	resync     time.Duration
+	// pullFailures and escalated are only accessed by the informer handler, which is never called concurrently
+	pullFailures map[string]map[string]time.Time
+	escalated    map[string]time.Time
+}
+
+// Name of the diagnostic in the registry.
+const Name = "podstatus"
+
+func init() {
+	diagnosis.Register(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		return NewPodStatusCollector(ctx.Client, ctx.Watch.Resync, ctx.Queue)
+	})
 }
 
-func NewPodStatusCollector(cli kubernetes.Interface) (diagnosis.Diagnostic, error) {
+func NewPodStatusCollector(cli kubernetes.Interface, resync time.Duration, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
 	return &podStatusCollector{
-		client:     cli,
-		eventsChan: make(chan events.CollectorEvent),
-		stop:       make(chan struct{}),
+		client:       cli,
+		resync:       resync,
+		eventsChan:   events.NewQueue[events.CollectorEvent]("podstatus", queueOpts),
+		stop:         make(chan struct{}),
+		pullFailures: map[string]map[string]time.Time{},
+		escalated:    map[string]time.Time{},
 	}, nil
 }
 
+// waitingFailures returns the failure reasons of waiting containers keyed by container name.
+func waitingFailures(pod *corev1.Pod) map[string]string {
+	res := map[string]string{}
+	if pod == nil {
+		return res
+	}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, cs := range statuses {
+			if cs.State.Waiting != nil && waitingFailureReasons.Has(cs.State.Waiting.Reason) {
+				res[cs.Name] = cs.State.Waiting.Reason
+			}
+		}
+	}
+	return res
+}
+
+func (p *podStatusCollector) onWaitingFailures(oldPod, newPod *corev1.Pod) {
+	oldFailures := waitingFailures(oldPod)
+	for _, statuses := range [][]corev1.ContainerStatus{newPod.Status.InitContainerStatuses, newPod.Status.ContainerStatuses} {
+		for _, cs := range statuses {
+			if cs.State.Waiting == nil || !waitingFailureReasons.Has(cs.State.Waiting.Reason) {
+				continue
+			}
+			if _, ok := oldFailures[cs.Name]; ok {
+				// already reported, e.g. ErrImagePull -> ImagePullBackOff
+				continue
+			}
+			p.eventsChan.Push(events.CollectorEvent{
+				TargetType: events.Pod,
+				Namespace:  newPod.Namespace,
+				Name:       newPod.Name,
+				EventType:  events.Error,
+				Reason:     cs.State.Waiting.Reason,
+				Message:    fmt.Sprintf("container %s is waiting: %s: %s", cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message),
+			})
+			if imagePullFailureReasons.Has(cs.State.Waiting.Reason) && newPod.Spec.NodeName != "" {
+				p.onImagePullFailure(newPod.Spec.NodeName, fmt.Sprintf("%s/%s", newPod.Namespace, newPod.Name))
+			}
+		}
+	}
+}
+
+// onImagePullFailure escalates to a node event when many pods fail to pull images on the same node.
+func (p *podStatusCollector) onImagePullFailure(nodeName, podKey string) {
+	now := time.Now()
+	pods, ok := p.pullFailures[nodeName]
+	if !ok {
+		pods = map[string]time.Time{}
+		p.pullFailures[nodeName] = pods
+	}
+	pods[podKey] = now
+	for k, t := range pods {
+		if now.Sub(t) > nodePullFailureWindow {
+			delete(pods, k)
+		}
+	}
+	if len(pods) < nodePullFailureThreshold {
+		return
+	}
+	if t, ok := p.escalated[nodeName]; ok && now.Sub(t) < nodePullFailureWindow {
+		return
+	}
+	p.escalated[nodeName] = now
+	p.eventsChan.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       nodeName,
+		EventType:  events.Warning,
+		Reason:     events.ReasonNodeImagePullFailures,
+		Message:    fmt.Sprintf("%d pods failed to pull images on node %s in the last %v", len(pods), nodeName, nodePullFailureWindow),
+	})
+}
+
 func (p *podStatusCollector) onPodUpdate(oldPod, newPod *corev1.Pod) {
 	if oldPod != nil {
-		if reflect.DeepEqual(oldPod.Status.ContainerStatuses, newPod.Status.ContainerStatuses) {
+		if reflect.DeepEqual(oldPod.Status.ContainerStatuses, newPod.Status.ContainerStatuses) &&
+			reflect.DeepEqual(oldPod.Status.InitContainerStatuses, newPod.Status.InitContainerStatuses) {
 			// no need to check
 			return
 		}
@@ -42,20 +150,22 @@ func (p *podStatusCollector) onPodUpdate(oldPod, newPod *corev1.Pod) {
 	for _, cs := range newPod.Status.ContainerStatuses {
 		if cs.State.Terminated != nil {
 			if cs.State.Terminated.Reason == "Error" {
-				p.eventsChan <- events.CollectorEvent{
+				p.eventsChan.Push(events.CollectorEvent{
 					TargetType: events.Pod,
 					Namespace:  newPod.Namespace,
 					Name:       newPod.Name,
 					EventType:  events.Error,
+					Reason:     events.ReasonError,
 					Message:    fmt.Sprintf("container %s terminated with error: %s, exit code: %d", cs.Name, cs.State.Terminated.Message, cs.State.Terminated.ExitCode),
-				}
+				})
 			}
 		}
 	}
+	p.onWaitingFailures(oldPod, newPod)
 }
 
 func (p *podStatusCollector) Start() error {
-	factory := informers.NewSharedInformerFactory(p.client, time.Minute)
+	factory := informers.NewSharedInformerFactory(p.client, p.resync)
 	informer := factory.Core().V1().Pods().Informer()
 	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -89,9 +199,9 @@ func (p *podStatusCollector) Start() error {
 
 func (p *podStatusCollector) Stop() {
 	close(p.stop)
-	close(p.eventsChan)
+	p.eventsChan.Close()
 }
 
 func (p *podStatusCollector) Events() <-chan events.CollectorEvent {
-	return p.eventsChan
+	return p.eventsChan.C()
 }
@@ -0,0 +1,121 @@
+package diagnosis
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Context is what a factory creates the diagnostic with.
+type Context struct {
+	// NodeName is the node of the agent, empty in the controller
+	NodeName   string
+	Client     kubernetes.Interface
+	RestConfig *rest.Config
+	Watch      events.WatchOptions
+	Queue      events.QueueOptions
+	// SysfsRoot is the mount point of the sysfs of the node, empty in the controller
+	SysfsRoot string
+	// RepeatInterval of reporting a problem which still exists
+	RepeatInterval time.Duration
+	// Options are the options of the diagnostic from the configuration, the type is defined by
+	// the diagnostic
+	Options any
+}
+
+// Factory creates a diagnostic.
+type Factory func(ctx Context) (Diagnostic, error)
+
+// AgentOptions are the options of a diagnostic of the agent. The section of the configuration of
+// the agent named like the diagnostic is decoded into them, and they are passed to the factory as
+// Context.Options. If they have a SetDefaults method, it is called after loading the
+// configuration.
+type AgentOptions interface {
+	// IsEnabled reports whether the diagnostic runs on the nodes which no node pool overrides
+	IsEnabled() bool
+	// Validate is called for the diagnostics which are enabled or enabled by a node pool
+	Validate(path *field.Path) field.ErrorList
+	// AddFlags binds the flags to the fields
+	AddFlags(fs *flag.FlagSet)
+}
+
+var (
+	registryMu   sync.RWMutex
+	registry     = map[string]Factory{}
+	agentOptions = map[string]func() AgentOptions{}
+)
+
+// Register makes the diagnostic available by name, it is called by the init of the diagnostic
+// packages and panics if the name is registered twice.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("diagnostic %s is registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// RegisterAgent registers a diagnostic of the agent, newOptions returns its options with the
+// defaults.
+func RegisterAgent(name string, factory Factory, newOptions func() AgentOptions) {
+	Register(name, factory)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	agentOptions[name] = newOptions
+}
+
+// NewAgentOptions returns the default options of the diagnostic, false if it is not a diagnostic
+// of the agent.
+func NewAgentOptions(name string) (AgentOptions, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	newOptions, ok := agentOptions[name]
+	if !ok {
+		return nil, false
+	}
+	return newOptions(), true
+}
+
+// Registered returns the sorted names of the registered diagnostics.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the diagnostic registered by name.
+func New(name string, ctx Context) (Diagnostic, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown diagnostic %s, registered: %v", name, Registered())
+	}
+	d, err := factory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create diagnostic %s error: %w", name, err)
+	}
+	return d, nil
+}
+
+// OptionsOf returns the options of the context, which must be of type T.
+func OptionsOf[T any](ctx Context) (T, error) {
+	opts, ok := ctx.Options.(T)
+	if !ok {
+		return opts, fmt.Errorf("expect options of type %T, got %T", opts, ctx.Options)
+	}
+	return opts, nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/config"
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ diagnosis.AgentOptions = (*Config)(nil)
+
+// Config is the storage section of the configuration of the agent.
+type Config struct {
+	// Probes are mount points of shared storage, the ones with the :rw suffix are write probed.
+	// Their failures are warnings unless they have the :error suffix, an outage of the storage
+	// server is not a fault of the nodes.
+	Probes config.StringList `json:"probes,omitempty"`
+	// EphemeralPaths are checked for free space and read-only remounts
+	EphemeralPaths config.StringList `json:"ephemeralPaths,omitempty"`
+	Interval       metav1.Duration   `json:"interval"`
+	Timeout        metav1.Duration   `json:"timeout"`
+	MinFreePercent float64           `json:"minFreePercent"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Interval:       metav1.Duration{Duration: time.Minute},
+		Timeout:        metav1.Duration{Duration: 10 * time.Second},
+		MinFreePercent: 5,
+	}
+}
+
+func (c *Config) IsEnabled() bool {
+	return len(c.Probes) > 0 || len(c.EphemeralPaths) > 0
+}
+
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	errs := config.ValidatePositive(nil, path.Child("interval"), c.Interval)
+	errs = config.ValidatePositive(errs, path.Child("timeout"), c.Timeout)
+	if _, err := ParseProbes(strings.Join(c.Probes, ",")); err != nil {
+		errs = append(errs, field.Invalid(path.Child("probes"), c.Probes.String(), err.Error()))
+	}
+	return errs
+}
+
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.Var(&c.Probes, "storage-probes", "comma separated mount points of shared storage to probe, the ones with the :rw suffix are write probed, failures are warnings unless the :error suffix is set")
+	fs.Var(&c.EphemeralPaths, "ephemeral-storage-paths", "comma separated paths of ephemeral storage checked for free space and read-only remounts")
+	fs.DurationVar(&c.Interval.Duration, "storage-interval", c.Interval.Duration, "interval of probing the storage")
+	fs.DurationVar(&c.Timeout.Duration, "storage-probe-timeout", c.Timeout.Duration, "timeout of probing a path")
+	fs.Float64Var(&c.MinFreePercent, "ephemeral-storage-min-free-percent", c.MinFreePercent, "minimum percent of free space and inodes of ephemeral storage")
+}
+
+func (c *Config) Options(ctx diagnosis.Context) (Options, error) {
+	probes, err := ParseProbes(strings.Join(c.Probes, ","))
+	if err != nil {
+		return Options{}, err
+	}
+	for _, p := range c.EphemeralPaths {
+		probes = append(probes, Probe{Path: p, Ephemeral: true})
+	}
+	return Options{
+		Probes:         probes,
+		Interval:       c.Interval.Duration,
+		Timeout:        c.Timeout.Duration,
+		MinFreePercent: c.MinFreePercent,
+		RepeatInterval: ctx.RepeatInterval,
+	}, nil
+}
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/diagnosis"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/runner"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*storageDiag)(nil)
+var _ diagnosis.Diagnostic = (*storageDiag)(nil)
+
+const (
+	ReasonProbeTimeout       = "StorageProbeTimeout"
+	ReasonProbeFailed        = "StorageProbeFailed"
+	ReasonReadOnlyFilesystem = "StorageReadOnly"
+	ReasonDiskPressure       = "StorageDiskPressure"
+)
+
+// Probe is a mount point checked by the diagnostic.
+type Probe struct {
+	Path string
+	// Write creates, syncs and removes a file in the path, the path is expected to be writable
+	Write bool
+	// Ephemeral paths are checked for free space
+	Ephemeral bool
+	// EventType of the failures of the probe. It defaults to Warning for shared storage, whose
+	// outage fails the probes of all the nodes at once and is not a fault of the node, and to Error
+	// for ephemeral storage.
+	EventType events.EventType
+}
+
+func (p Probe) eventType() events.EventType {
+	switch {
+	case p.EventType != 0:
+		return p.EventType
+	case p.Ephemeral:
+		return events.Error
+	}
+	return events.Warning
+}
+
+type Options struct {
+	Probes   []Probe
+	Interval time.Duration
+	// Timeout of probing a path, shared file systems may block forever when the server is gone
+	Timeout time.Duration
+	// MinFreePercent of the blocks and inodes of ephemeral paths
+	MinFreePercent float64
+	// RepeatInterval is how often a problem which still exists is reported again
+	RepeatInterval time.Duration
+}
+
+type probeResult struct {
+	readOnly          bool
+	freeBlocksPercent float64
+	freeInodesPercent float64
+	hasInodes         bool
+	err               error
+}
+
+type storageDiag struct {
+	nodeName string
+	opts     Options
+	events   *events.Queue[events.CollectorEvent]
+	stop     chan struct{}
+
+	// only accessed by the check loop
+	fired map[string]time.Time
+
+	mu sync.Mutex
+	// hanging are the paths whose probe has not returned, they are not probed again until it returns
+	// so that a dead mount does not leak a goroutine every interval
+	hanging map[string]time.Time
+}
+
+// ParseProbes parses comma separated paths like "/mnt/data,/mnt/ckpt:rw,/mnt/local:rw:error", the
+// paths with the rw suffix are write probed and the ones with the error suffix report their
+// failures as errors instead of warnings.
+func ParseProbes(s string) ([]Probe, error) {
+	var probes []Probe
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		p := Probe{Path: parts[0]}
+		for _, suffix := range parts[1:] {
+			switch suffix {
+			case "ro":
+			case "rw":
+				p.Write = true
+			case "error":
+				p.EventType = events.Error
+			case "warning":
+				p.EventType = events.Warning
+			default:
+				return nil, fmt.Errorf("invalid suffix %q of probe %s", suffix, p.Path)
+			}
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// Name of the diagnostic in the registry.
+const Name = "storage"
+
+func init() {
+	diagnosis.RegisterAgent(Name, func(ctx diagnosis.Context) (diagnosis.Diagnostic, error) {
+		conf, err := diagnosis.OptionsOf[*Config](ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := conf.Options(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewStorageDiagnosis(ctx.NodeName, opts, ctx.Queue)
+	}, func() diagnosis.AgentOptions {
+		return NewConfig()
+	})
+}
+
+func NewStorageDiagnosis(nodeName string, opts Options, queueOpts events.QueueOptions) (diagnosis.Diagnostic, error) {
+	for _, p := range opts.Probes {
+		if !filepath.IsAbs(p.Path) {
+			return nil, fmt.Errorf("probe path %q is not absolute", p.Path)
+		}
+	}
+	return &storageDiag{
+		nodeName: nodeName,
+		opts:     opts,
+		events:   events.NewQueue[events.CollectorEvent]("storage", queueOpts),
+		stop:     make(chan struct{}),
+		fired:    map[string]time.Time{},
+		hanging:  map[string]time.Time{},
+	}, nil
+}
+
+func (d *storageDiag) Start() error {
+	go func() {
+		t := time.NewTicker(d.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.check(time.Now())
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *storageDiag) Stop() {
+	close(d.stop)
+	d.events.Close()
+}
+
+func (d *storageDiag) Events() <-chan events.CollectorEvent {
+	return d.events.C()
+}
+
+// probe runs the file system operations on the path, it may block forever.
+func (d *storageDiag) probe(p Probe) probeResult {
+	var res probeResult
+	if _, err := os.Stat(p.Path); err != nil {
+		res.err = err
+		return res
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(p.Path, &st); err != nil {
+		res.err = fmt.Errorf("statfs: %w", err)
+		return res
+	}
+	res.readOnly = st.Flags&unix.ST_RDONLY != 0
+	if st.Blocks > 0 {
+		res.freeBlocksPercent = float64(st.Bavail) / float64(st.Blocks) * 100
+	}
+	// some file systems like btrfs do not report inodes
+	if st.Files > 0 {
+		res.hasInodes = true
+		res.freeInodesPercent = float64(st.Ffree) / float64(st.Files) * 100
+	}
+
+	f, err := os.Open(p.Path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	_, err = f.Readdirnames(1)
+	_ = f.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		res.err = fmt.Errorf("read dir: %w", err)
+		return res
+	}
+
+	if p.Write && !res.readOnly {
+		res.err = writeProbe(filepath.Join(p.Path, ".kcover-probe-"+d.nodeName))
+	}
+	return res
+}
+
+func writeProbe(name string) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(name)
+	if _, err := f.WriteString(time.Now().Format(time.RFC3339Nano)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("sync: %w", err)
+	}
+	return f.Close()
+}
+
+func (d *storageDiag) check(now time.Time) {
+	for _, p := range d.opts.Probes {
+		d.mu.Lock()
+		since, hanging := d.hanging[p.Path]
+		d.mu.Unlock()
+		if hanging {
+			d.report(p.Path, ReasonProbeTimeout, p.eventType(), fmt.Sprintf("probe of %s has not returned for %v", p.Path, now.Sub(since).Round(time.Second)), now)
+			continue
+		}
+		d.checkPath(p, now)
+	}
+}
+
+func (d *storageDiag) checkPath(p Probe, now time.Time) {
+	d.mu.Lock()
+	d.hanging[p.Path] = now
+	d.mu.Unlock()
+	done := make(chan probeResult, 1)
+	go func() {
+		res := d.probe(p)
+		if elapsed := time.Since(now); elapsed > d.opts.Timeout {
+			klog.Infof("probe of %s returned after %v, error: %v", p.Path, elapsed.Round(time.Second), res.err)
+		}
+		d.mu.Lock()
+		delete(d.hanging, p.Path)
+		d.mu.Unlock()
+		done <- res
+	}()
+
+	var res probeResult
+	select {
+	case res = <-done:
+	case <-time.After(d.opts.Timeout):
+		d.report(p.Path, ReasonProbeTimeout, p.eventType(), fmt.Sprintf("probe of %s did not return in %v", p.Path, d.opts.Timeout), now)
+		return
+	case <-d.stop:
+		return
+	}
+
+	if res.err != nil {
+		d.report(p.Path, ReasonProbeFailed, p.eventType(), fmt.Sprintf("probe of %s failed: %v", p.Path, res.err), now)
+		return
+	}
+	if res.readOnly && (p.Write || p.Ephemeral) {
+		d.report(p.Path, ReasonReadOnlyFilesystem, p.eventType(), fmt.Sprintf("%s is mounted read-only", p.Path), now)
+		return
+	}
+	if p.Ephemeral {
+		if res.freeBlocksPercent < d.opts.MinFreePercent {
+			d.report(p.Path, ReasonDiskPressure, events.Warning,
+				fmt.Sprintf("%s has %.1f%% space free, below %g%%", p.Path, res.freeBlocksPercent, d.opts.MinFreePercent), now)
+		} else if res.hasInodes && res.freeInodesPercent < d.opts.MinFreePercent {
+			d.report(p.Path, ReasonDiskPressure, events.Warning,
+				fmt.Sprintf("%s has %.1f%% inodes free, below %g%%", p.Path, res.freeInodesPercent, d.opts.MinFreePercent), now)
+		}
+	}
+}
+
+func (d *storageDiag) report(path, reason string, eventType events.EventType, message string, now time.Time) {
+	key := reason + "/" + path
+	if t, ok := d.fired[key]; ok && now.Sub(t) < d.opts.RepeatInterval {
+		return
+	}
+	d.fired[key] = now
+	d.events.Push(events.CollectorEvent{
+		TargetType: events.Node,
+		Name:       d.nodeName,
+		EventType:  eventType,
+		Reason:     reason,
+		Message:    message,
+	})
+}
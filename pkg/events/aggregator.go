@@ -0,0 +1,172 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/runner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Incident is the consolidation of the collector events of one job or node within an aggregation window.
+type Incident struct {
+	// TargetType is Job for pods owned by a job, otherwise the target type of the events
+	TargetType TargetType
+	Namespace  string
+	Name       string
+	// EventType is the most severe type of the events
+	EventType EventType
+	// Events are de-duplicated by target and reason, in the order they were received
+	Events    []CollectorEvent
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Key identifies the target of the incident, the incidents of a job and of the nodes it runs on
+// have different keys.
+func (i Incident) Key() string {
+	if i.Namespace == "" {
+		return fmt.Sprintf("%s/%s", i.TargetType, i.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", i.TargetType, i.Namespace, i.Name)
+}
+
+var _ runner.Runner = (*Aggregator)(nil)
+
+// Aggregator groups the events of the same job or node received within a window, so that
+// recovery handles one incident instead of one event per failed pod.
+type Aggregator struct {
+	sources   []<-chan CollectorEvent
+	factory   informers.SharedInformerFactory
+	pods      corelisters.PodLister
+	incidents *Queue[Incident]
+	stop      chan struct{}
+
+	mu      sync.Mutex
+	window  time.Duration
+	pending map[string]*Incident
+}
+
+func NewAggregator(cli kubernetes.Interface, window, resync time.Duration, queueOpts QueueOptions, sources ...<-chan CollectorEvent) *Aggregator {
+	// only job pods are needed to resolve the job of a pod event
+	factory := informers.NewSharedInformerFactoryWithOptions(cli, resync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = constants.KubeflowJobLabel
+	}))
+	return &Aggregator{
+		window:    window,
+		sources:   sources,
+		factory:   factory,
+		pods:      factory.Core().V1().Pods().Lister(),
+		incidents: NewQueue[Incident]("incidents", queueOpts),
+		stop:      make(chan struct{}),
+		pending:   map[string]*Incident{},
+	}
+}
+
+func (a *Aggregator) Start() error {
+	a.factory.Start(a.stop)
+	for typ, synced := range a.factory.WaitForCacheSync(a.stop) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer cache of %v", typ)
+		}
+	}
+	for _, source := range a.sources {
+		go func(source <-chan CollectorEvent) {
+			for e := range source {
+				a.add(e)
+			}
+		}(source)
+	}
+	return nil
+}
+
+func (a *Aggregator) Stop() {
+	close(a.stop)
+	a.incidents.Close()
+}
+
+func (a *Aggregator) Incidents() <-chan Incident {
+	return a.incidents.C()
+}
+
+// incidentOf returns the empty incident which the event belongs to.
+func (a *Aggregator) incidentOf(e CollectorEvent) Incident {
+	switch e.TargetType {
+	case Pod:
+		pod, err := a.pods.Pods(e.Namespace).Get(e.Name)
+		if err == nil && pod.Labels[constants.KubeflowJobLabel] != "" {
+			return Incident{TargetType: Job, Namespace: e.Namespace, Name: pod.Labels[constants.KubeflowJobLabel]}
+		}
+		return Incident{TargetType: Pod, Namespace: e.Namespace, Name: e.Name}
+	case Device:
+		// device events are handled by their node
+		return Incident{TargetType: Node, Name: e.Name}
+	default:
+		return Incident{TargetType: e.TargetType, Namespace: e.Namespace, Name: e.Name}
+	}
+}
+
+func (a *Aggregator) add(e CollectorEvent) {
+	now := time.Now()
+	in := a.incidentOf(e)
+	key := in.Key()
+
+	a.mu.Lock()
+	window := a.window
+	pending, ok := a.pending[key]
+	if !ok {
+		in.FirstSeen = now
+		pending = &in
+		a.pending[key] = pending
+		if window > 0 {
+			time.AfterFunc(window, func() {
+				a.flush(key)
+			})
+		}
+	}
+	pending.LastSeen = now
+	if pending.EventType == 0 || e.EventType == Error {
+		pending.EventType = e.EventType
+	}
+	duplicated := false
+	for _, pe := range pending.Events {
+		if pe.TargetType == e.TargetType && pe.Namespace == e.Namespace && pe.Name == e.Name && pe.Reason == e.Reason {
+			duplicated = true
+			break
+		}
+	}
+	if !duplicated {
+		pending.Events = append(pending.Events, e)
+	} else {
+		klog.V(4).Infof("collapse duplicated event %+v into incident %s", e, key)
+	}
+	a.mu.Unlock()
+
+	if window <= 0 {
+		a.flush(key)
+	}
+}
+
+// SetWindow changes the window of the incidents created from now on.
+func (a *Aggregator) SetWindow(window time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.window = window
+}
+
+func (a *Aggregator) flush(key string) {
+	a.mu.Lock()
+	in, ok := a.pending[key]
+	delete(a.pending, key)
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+	a.incidents.Push(*in)
+}
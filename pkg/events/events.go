@@ -1,6 +1,12 @@
 package events
 
-import "github.com/baizeai/kcover/pkg/runner"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/runner"
+)
 
 type TargetType string
 
@@ -8,6 +14,8 @@ const (
 	Pod    TargetType = "pod"
 	Node   TargetType = "node"
 	Device TargetType = "device"
+	// Job is only used by incidents which group the pod events of a job
+	Job TargetType = "job"
 )
 
 type EventType int
@@ -18,12 +26,81 @@ const (
 	Warning
 )
 
+func (t EventType) String() string {
+	switch t {
+	case Error:
+		return "Error"
+	case Warning:
+		return "Warning"
+	}
+	return "Unknown"
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *EventType) UnmarshalText(text []byte) error {
+	switch s := string(text); {
+	case strings.EqualFold(s, Error.String()):
+		*t = Error
+	case strings.EqualFold(s, Warning.String()):
+		*t = Warning
+	case s == "" || s == "Unknown":
+		*t = 0
+	default:
+		return fmt.Errorf("unknown event type %q", s)
+	}
+	return nil
+}
+
+// ParseEventType parses the value produced by EventType.String, unknown values are treated as Error.
+func ParseEventType(s string) EventType {
+	if strings.EqualFold(s, Warning.String()) {
+		return Warning
+	}
+	return Error
+}
+
+// reasons of collector events, pod waiting reasons are the same as the ones reported by kubelet
+const (
+	ReasonError                      = "Error"
+	ReasonErrImagePull               = "ErrImagePull"
+	ReasonImagePullBackOff           = "ImagePullBackOff"
+	ReasonCreateContainerConfigError = "CreateContainerConfigError"
+	ReasonRunContainerError          = "RunContainerError"
+	ReasonNodeImagePullFailures      = "NodeImagePullFailures"
+)
+
 type CollectorEvent struct {
-	TargetType
-	Namespace string
-	Name      string
-	EventType
-	Message string
+	TargetType TargetType `json:"targetType"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Name       string     `json:"name"`
+	// Device identifies the faulty device, e.g. the GPU UUID or PCI address, of Device events whose Name is the node
+	Device string `json:"device,omitempty"`
+	// EventType is a named field, embedding it would promote String and break the %+v format of the event
+	EventType EventType `json:"eventType"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+const (
+	// DefaultMaxEventAge is how long a fault event is considered fresh enough to trigger recovery.
+	DefaultMaxEventAge = 3 * time.Minute
+	// DefaultResync is the resync period of the informers.
+	DefaultResync = time.Minute
+)
+
+// WatchOptions are shared by the components watching the cluster for fault events.
+type WatchOptions struct {
+	Resync time.Duration
+	// MaxEventAge is how long a fault event is considered fresh enough to trigger recovery
+	MaxEventAge time.Duration
+}
+
+var DefaultWatchOptions = WatchOptions{
+	Resync:      DefaultResync,
+	MaxEventAge: DefaultMaxEventAge,
 }
 
 type Recorder interface {
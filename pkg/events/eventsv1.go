@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// API of the events recorded by kcover. The watcher of the controller understands both, so the
+// agents can be migrated one by one.
+type API string
+
+const (
+	// CoreV1 records core/v1 events, repeated faults increase the count of the event
+	CoreV1 API = "v1"
+	// EventsV1 records events.k8s.io/v1 events, repeated faults are counted in the event series
+	EventsV1 API = "events.k8s.io/v1"
+)
+
+func (a API) Validate() error {
+	switch a {
+	case CoreV1, EventsV1:
+		return nil
+	}
+	return fmt.Errorf("unknown events api %q, expect %s or %s", a, CoreV1, EventsV1)
+}
+
+const (
+	// ReportingController of the events.k8s.io/v1 events
+	ReportingController = "kcover.io/kcover"
+	// ActionDetectFault is the action of the fault events
+	ActionDetectFault = "DetectFault"
+
+	// seriesWindow in which a repeated fault is counted in the series of its event, like the
+	// events library of client-go
+	seriesWindow = 6 * time.Minute
+	// maxNoteLength of events.k8s.io/v1 events
+	maxNoteLength = 1024
+)
+
+// series is the event of a fault and the times it was recorded.
+type series struct {
+	namespace string
+	name      string
+	count     int32
+	// stale if the last patch failed, it may have been applied all the same, so the count is read
+	// again before the next patch
+	stale bool
+}
+
+func newSeriesCache() *ttlcache.Cache[string, *series] {
+	return ttlcache.New[string, *series](ttlcache.WithTTL[string, *series](seriesWindow))
+}
+
+func truncateNote(note string) string {
+	if len(note) <= maxNoteLength {
+		return note
+	}
+	return strings.ToValidUTF8(note[:maxNoteLength], "")
+}
+
+// recordV1 records the fault as an events.k8s.io/v1 event, a fault repeated in the series window
+// updates the series of its event instead of creating a new one.
+func (a *kubeEventsRecorder) recordV1(regarding, related *corev1.ObjectReference, e CollectorEvent) error {
+	reason := e.Reason
+	if reason == "" {
+		reason = ReasonError
+	}
+	note := truncateNote(e.Message)
+	key := strings.Join([]string{regarding.Kind, regarding.Namespace, regarding.Name, string(regarding.UID),
+		e.EventType.String(), e.Device, reason, note}, "/")
+	now := metav1.NowMicro()
+	ctx := context.Background()
+
+	// the records of a fault are serialized so that they count in one series, the records of
+	// different faults do not wait for each other
+	defer a.seriesLocks.Lock(key)()
+	a.series.DeleteExpired()
+	if item := a.series.Get(key); item != nil {
+		found, err := a.patchSeries(ctx, key, *item.Value(), now)
+		if found || err != nil {
+			return err
+		}
+		// the event has been garbage collected, start a new one
+	}
+
+	namespace := regarding.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	event := &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%v.%x", regarding.Name, now.UnixNano()),
+			Namespace:   namespace,
+			Annotations: eventAnnotations(e),
+		},
+		EventTime:           now,
+		ReportingController: ReportingController,
+		ReportingInstance:   a.instance,
+		Action:              ActionDetectFault,
+		Reason:              reason,
+		Regarding:           *regarding,
+		Related:             related,
+		Note:                note,
+		Type:                corev1.EventTypeWarning,
+	}
+	created, err := a.client.EventsV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	a.series.Set(key, &series{namespace: namespace, name: created.Name, count: 1}, ttlcache.DefaultTTL)
+	return nil
+}
+
+// patchSeries counts the fault in the series of its event, it returns false if the event is gone.
+func (a *kubeEventsRecorder) patchSeries(ctx context.Context, key string, s series, now metav1.MicroTime) (bool, error) {
+	client := a.client.EventsV1().Events(s.namespace)
+	if s.stale {
+		event, err := client.Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		s.count = 1
+		if event.Series != nil {
+			s.count = event.Series.Count
+		}
+		s.stale = false
+	}
+	data, err := json.Marshal(map[string]any{
+		"series": eventsv1.EventSeries{Count: s.count + 1, LastObservedTime: now},
+	})
+	if err != nil {
+		return true, err
+	}
+	_, err = client.Patch(ctx, s.name, types.MergePatchType, data, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		s.stale = true
+		a.series.Set(key, &s, ttlcache.DefaultTTL)
+		return true, err
+	}
+	s.count++
+	a.series.Set(key, &s, ttlcache.DefaultTTL)
+	return true, nil
+}
+
+// ObservedTime is the last time the event happened, events.k8s.io/v1 events keep it in the series
+// or the event time, core/v1 events in the last timestamp.
+func ObservedTime(e *corev1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+// ObservedCount is the number of times the event happened in either api.
+func ObservedCount(e *corev1.Event) int32 {
+	if e.Series != nil {
+		return e.Series.Count
+	}
+	if e.Count == 0 {
+		return 1
+	}
+	return e.Count
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNode = "worker-a800-2"
+
+var testFault = CollectorEvent{
+	TargetType: Node,
+	Name:       testNode,
+	EventType:  Error,
+	Reason:     "XidError",
+	Message:    "GPU-0 reported xid 79",
+}
+
+var testNodeRef = &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: testNode}
+
+func newTestRecorder() (*fake.Clientset, Recorder) {
+	cli := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNode}})
+	return cli, NewKubeEventsRecorder(cli, false, EventsV1, DefaultWatchOptions, DefaultQueueOptions)
+}
+
+// seriesCount returns the count of the only event of the fault.
+func seriesCount(t *testing.T, cli *fake.Clientset) int32 {
+	t.Helper()
+	list, err := cli.EventsV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d events, want 1", len(list.Items))
+	}
+	if list.Items[0].Series == nil {
+		return 1
+	}
+	return list.Items[0].Series.Count
+}
+
+func TestRecordV1Series(t *testing.T) {
+	tests := []struct {
+		name       string
+		concurrent bool
+	}{
+		{name: "sequential"},
+		{name: "concurrent", concurrent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, recorder := newTestRecorder()
+			cli.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				// a concurrent record of the fault misses the series while the event is created
+				time.Sleep(50 * time.Millisecond)
+				return false, nil, nil
+			})
+			var wg sync.WaitGroup
+			errs := make(chan error, 2)
+			for i := 0; i < 2; i++ {
+				record := func() {
+					defer wg.Done()
+					// recordV1 is called directly, the fake clientset serializes the calls and
+					// the get of the node would serialize the records
+					errs <- recorder.(*kubeEventsRecorder).recordV1(testNodeRef, nil, testFault)
+				}
+				wg.Add(1)
+				if tt.concurrent {
+					go record()
+				} else {
+					record()
+				}
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if count := seriesCount(t, cli); count != 2 {
+				t.Errorf("series count %d, want 2", count)
+			}
+		})
+	}
+}
+
+func TestRecordV1LostPatchResponse(t *testing.T) {
+	cli, recorder := newTestRecorder()
+	lost := true
+	cli.PrependReactor("patch", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !lost {
+			return false, nil, nil
+		}
+		lost = false
+		// the patch is applied but its response does not arrive
+		if _, _, err := k8stesting.ObjectReaction(cli.Tracker())(action); err != nil {
+			return true, nil, err
+		}
+		return true, nil, fmt.Errorf("connection reset by peer")
+	})
+
+	if err := recorder.RecordEvent(testFault); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.RecordEvent(testFault); err == nil {
+		t.Fatal("the lost patch response is not an error")
+	}
+	if err := recorder.RecordEvent(testFault); err != nil {
+		t.Fatal(err)
+	}
+	if count := seriesCount(t, cli); count != 3 {
+		t.Errorf("series count %d, want 3", count)
+	}
+}
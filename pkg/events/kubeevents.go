@@ -3,6 +3,7 @@ package events
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -15,6 +16,8 @@ import (
 	"k8s.io/client-go/tools/reference"
 
 	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/keymutex"
+	"github.com/jellydator/ttlcache/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
@@ -24,25 +27,42 @@ import (
 
 type kubeEventsRecorder struct {
 	client     kubernetes.Interface
-	eventChan  chan CollectorEvent
+	eventChan  *Queue[CollectorEvent]
 	stop       chan struct{}
 	watchEvent bool
-	recorder   record.EventRecorder
+	watchOpts  WatchOptions
+	api        API
+	// recorder of the core/v1 api
+	recorder record.EventRecorder
+	// instance and series of the events.k8s.io/v1 api, seriesLocks are keyed like the series
+	instance    string
+	series      *ttlcache.Cache[string, *series]
+	seriesLocks *keymutex.KeyedMutex
 }
 
-func NewKubeEventsRecorder(cli kubernetes.Interface, watchEvent bool) Recorder {
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartRecordingToSink(&v1.EventSinkImpl{
-		Interface: cli.CoreV1().Events(""),
-	})
-	recorder := eventBroadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "kcover"})
-	return &kubeEventsRecorder{
+// NewKubeEventsRecorder records the fault events with the api, and watches the fault events of
+// both apis if watchEvent is set.
+func NewKubeEventsRecorder(cli kubernetes.Interface, watchEvent bool, api API, watchOpts WatchOptions, queueOpts QueueOptions) Recorder {
+	a := &kubeEventsRecorder{
 		client:     cli,
-		eventChan:  make(chan CollectorEvent),
+		eventChan:  NewQueue[CollectorEvent]("kube-events", queueOpts),
 		stop:       make(chan struct{}),
 		watchEvent: watchEvent,
-		recorder:   recorder,
+		watchOpts:  watchOpts,
+		api:        api,
 	}
+	if api == EventsV1 {
+		a.instance, _ = os.Hostname()
+		a.series = newSeriesCache()
+		a.seriesLocks = keymutex.New()
+		return a
+	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&v1.EventSinkImpl{
+		Interface: cli.CoreV1().Events(""),
+	})
+	a.recorder = eventBroadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "kcover"})
+	return a
 }
 
 func (a *kubeEventsRecorder) Start() error {
@@ -50,48 +70,18 @@ func (a *kubeEventsRecorder) Start() error {
 		return nil
 	}
 
-	factory := informers.NewSharedInformerFactory(a.client, time.Minute)
+	factory := informers.NewSharedInformerFactory(a.client, a.watchOpts.Resync)
 	informer := factory.Core().V1().Events().Informer()
 
 	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			event := obj.(*corev1.Event)
-			eventTimestamp := event.LastTimestamp
-			if eventTimestamp.IsZero() {
-				eventTimestamp = event.CreationTimestamp
-			}
-			if eventTimestamp.Add(3 * time.Minute).Before(time.Now()) {
-				klog.Infof("event %s is too old %s against %s, ignore it", event.Name, eventTimestamp.String(), time.Now().String())
-				return
-			}
-			if event.Annotations[constants.NeedRecoveryAnnotation] == "true" {
-				obj := event.InvolvedObject
-				switch obj.GroupVersionKind() {
-				case schema.GroupVersionKind{
-					Group:   "",
-					Version: "v1",
-					Kind:    "Pod",
-				}:
-					a.eventChan <- CollectorEvent{
-						TargetType: Pod,
-						Namespace:  obj.Namespace,
-						Name:       obj.Name,
-						EventType:  Error, // todo change me
-						Message:    event.Message,
-					}
-				case schema.GroupVersionKind{
-					Group:   "",
-					Version: "v1",
-					Kind:    "Node",
-				}:
-					a.eventChan <- CollectorEvent{
-						TargetType: Node,
-						Name:       obj.Name,
-						EventType:  Error, // todo change me
-						Message:    event.Message,
-					}
-				}
-				return
+			a.onEvent(obj.(*corev1.Event))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// a repeated fault increases the count of a core/v1 event or the series of an
+			// events.k8s.io/v1 event
+			if ObservedCount(newObj.(*corev1.Event)) > ObservedCount(oldObj.(*corev1.Event)) {
+				a.onEvent(newObj.(*corev1.Event))
 			}
 		},
 	})
@@ -104,8 +94,55 @@ func (a *kubeEventsRecorder) Start() error {
 	return nil
 }
 
+// onEvent pushes the fault events recorded by kcover. The events of both apis are watched by the
+// core/v1 api, which shows the regarding object of events.k8s.io/v1 events as the involved object.
+func (a *kubeEventsRecorder) onEvent(event *corev1.Event) {
+	if event.Annotations[constants.NeedRecoveryAnnotation] != constants.True {
+		return
+	}
+	eventTimestamp := ObservedTime(event)
+	if eventTimestamp.Add(a.watchOpts.MaxEventAge).Before(time.Now()) {
+		klog.Infof("event %s is too old %s against %s, ignore it", event.Name, eventTimestamp.String(), time.Now().String())
+		return
+	}
+	obj := event.InvolvedObject
+	switch obj.GroupVersionKind() {
+	case schema.GroupVersionKind{
+		Group:   "",
+		Version: "v1",
+		Kind:    "Pod",
+	}:
+		a.eventChan.Push(CollectorEvent{
+			TargetType: Pod,
+			Namespace:  obj.Namespace,
+			Name:       obj.Name,
+			EventType:  ParseEventType(event.Annotations[constants.EventTypeAnnotation]),
+			Reason:     event.Reason,
+			Message:    event.Message,
+		})
+	case schema.GroupVersionKind{
+		Group:   "",
+		Version: "v1",
+		Kind:    "Node",
+	}:
+		e := CollectorEvent{
+			TargetType: Node,
+			Name:       obj.Name,
+			EventType:  ParseEventType(event.Annotations[constants.EventTypeAnnotation]),
+			Reason:     event.Reason,
+			Message:    event.Message,
+		}
+		if device := event.Annotations[constants.DeviceAnnotation]; device != "" {
+			e.TargetType = Device
+			e.Device = device
+		}
+		a.eventChan.Push(e)
+	}
+}
+
 func (a *kubeEventsRecorder) Stop() {
 	close(a.stop)
+	a.eventChan.Close()
 }
 
 func (a *kubeEventsRecorder) recordToPod(e CollectorEvent) error {
@@ -118,12 +155,12 @@ func (a *kubeEventsRecorder) recordToPod(e CollectorEvent) error {
 		return err
 	}
 
+	var related *corev1.ObjectReference
+	if pod.Spec.NodeName != "" {
+		related = &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: pod.Spec.NodeName}
+	}
 	// 记录事件
-	a.recorder.AnnotatedEventf(ref, map[string]string{
-		constants.NeedRecoveryAnnotation: "true",
-	}, corev1.EventTypeWarning, "Error", e.Message)
-
-	return nil
+	return a.recordAnnotated(ref, related, e)
 }
 
 func (a *kubeEventsRecorder) recordToNode(e CollectorEvent) error {
@@ -138,10 +175,31 @@ func (a *kubeEventsRecorder) recordToNode(e CollectorEvent) error {
 	}
 
 	// 记录事件
-	a.recorder.AnnotatedEventf(ref, map[string]string{
-		constants.NeedRecoveryAnnotation: "true",
-	}, corev1.EventTypeWarning, "Error", e.Message)
+	return a.recordAnnotated(ref, nil, e)
+}
 
+func eventAnnotations(e CollectorEvent) map[string]string {
+	annotations := map[string]string{
+		constants.NeedRecoveryAnnotation: constants.True,
+		constants.EventTypeAnnotation:    e.EventType.String(),
+	}
+	if e.Device != "" {
+		annotations[constants.DeviceAnnotation] = e.Device
+	}
+	return annotations
+}
+
+// recordAnnotated records the fault event of the object, the related object is only kept by the
+// events.k8s.io/v1 api.
+func (a *kubeEventsRecorder) recordAnnotated(ref, related *corev1.ObjectReference, e CollectorEvent) error {
+	if a.api == EventsV1 {
+		return a.recordV1(ref, related, e)
+	}
+	reason := e.Reason
+	if reason == "" {
+		reason = ReasonError
+	}
+	a.recorder.AnnotatedEventf(ref, eventAnnotations(e), corev1.EventTypeWarning, reason, e.Message)
 	return nil
 }
 
@@ -150,7 +208,8 @@ func (a *kubeEventsRecorder) RecordEvent(e CollectorEvent) error {
 	switch e.TargetType {
 	case Pod:
 		err = a.recordToPod(e)
-	case Node:
+	case Node, Device:
+		// device events are recorded to their node
 		err = a.recordToNode(e)
 	default:
 		//TODO implement me
@@ -160,5 +219,5 @@ func (a *kubeEventsRecorder) RecordEvent(e CollectorEvent) error {
 }
 
 func (a *kubeEventsRecorder) EventChan() <-chan CollectorEvent {
-	return a.eventChan
+	return a.eventChan.C()
 }
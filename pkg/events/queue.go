@@ -0,0 +1,129 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/baizeai/kcover/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+type OverflowPolicy string
+
+const (
+	// DropOldest discards the oldest queued item to make room for the new one
+	DropOldest OverflowPolicy = "DropOldest"
+	// DropNewest discards the item being pushed
+	DropNewest OverflowPolicy = "DropNewest"
+)
+
+type QueueOptions struct {
+	Size   int
+	Policy OverflowPolicy
+}
+
+var DefaultQueueOptions = QueueOptions{
+	Size:   1024,
+	Policy: DropOldest,
+}
+
+func (o QueueOptions) Validate() error {
+	if o.Size <= 0 {
+		return fmt.Errorf("queue size must be positive, got %d", o.Size)
+	}
+	switch o.Policy {
+	case DropOldest, DropNewest:
+	default:
+		return fmt.Errorf("unknown overflow policy %q", o.Policy)
+	}
+	return nil
+}
+
+var (
+	queueDepth = metrics.NewGaugeFuncVec("kcover_event_queue_depth",
+		"Number of items waiting in the queue.", "queue")
+	queueCapacity = metrics.NewGaugeVec("kcover_event_queue_capacity",
+		"Capacity of the queue.", "queue")
+	queuePushed = metrics.NewCounterVec("kcover_event_queue_pushed_total",
+		"Number of items pushed into the queue.", "queue")
+	queueDropped = metrics.NewCounterVec("kcover_event_queue_dropped_total",
+		"Number of items dropped because the queue was full or closed.", "queue", "policy")
+)
+
+// Queue is a bounded buffer between producers which must never block, like informer handlers,
+// and slower consumers. Items are dropped according to the overflow policy when it is full.
+type Queue[T any] struct {
+	name   string
+	policy OverflowPolicy
+	ch     chan T
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewQueue[T any](name string, opts QueueOptions) *Queue[T] {
+	if opts.Size <= 0 {
+		opts.Size = DefaultQueueOptions.Size
+	}
+	if opts.Policy == "" {
+		opts.Policy = DefaultQueueOptions.Policy
+	}
+	q := &Queue[T]{
+		name:   name,
+		policy: opts.Policy,
+		ch:     make(chan T, opts.Size),
+	}
+	queueDepth.SetFunc(func() float64 { return float64(len(q.ch)) }, name)
+	queueCapacity.WithLabelValues(name).Set(float64(opts.Size))
+	return q
+}
+
+// Push enqueues the item without blocking, it returns false if the item was not enqueued.
+func (q *Queue[T]) Push(item T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		queueDropped.WithLabelValues(q.name, "closed").Inc()
+		return false
+	}
+	queuePushed.WithLabelValues(q.name).Inc()
+	select {
+	case q.ch <- item:
+		return true
+	default:
+	}
+	queueDropped.WithLabelValues(q.name, string(q.policy)).Inc()
+	if q.policy == DropNewest {
+		klog.Warningf("queue %s is full, drop the newest item", q.name)
+		return false
+	}
+	klog.Warningf("queue %s is full, drop the oldest item", q.name)
+	select {
+	case <-q.ch:
+	default:
+	}
+	select {
+	case q.ch <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *Queue[T]) C() <-chan T {
+	return q.ch
+}
+
+func (q *Queue[T]) Len() int {
+	return len(q.ch)
+}
+
+// Close closes the channel, items pushed afterwards are dropped.
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+}
@@ -0,0 +1,40 @@
+package keymutex
+
+import "sync"
+
+// KeyedMutex locks by key, the lock of a key is dropped once nobody holds or waits for it.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func New() *KeyedMutex {
+	return &KeyedMutex{locks: map[string]*refMutex{}}
+}
+
+// Lock the key, the returned func unlocks it.
+func (k *KeyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &refMutex{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
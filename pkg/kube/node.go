@@ -0,0 +1,24 @@
+package kube
+
+import (
+	"github.com/baizeai/kcover/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CordonedByKcover returns whether the node was cordoned by the recovery controller.
+func CordonedByKcover(node *corev1.Node) bool {
+	if _, ok := node.Annotations[constants.CordonedAtAnnotation]; ok {
+		return true
+	}
+	for _, t := range node.Spec.Taints {
+		if t.Key == constants.UnhealthyTaintKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Quarantined returns whether the node was quarantined for too many faults.
+func Quarantined(node *corev1.Node) bool {
+	return node.Labels[constants.QuarantinedLabel] == constants.True
+}
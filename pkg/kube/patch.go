@@ -0,0 +1,147 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// all mutations are made by patches under the kcover field manager, so they are attributable
+// in managedFields and never overwrite fields which kcover does not own.
+
+var patchOptions = metav1.PatchOptions{FieldManager: constants.FieldManager}
+
+// AnnotationsPatch builds a merge patch of the annotations, nil values remove the annotation.
+func AnnotationsPatch(annotations map[string]*string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": annotations,
+		},
+	})
+}
+
+func PatchNodeAnnotations(ctx context.Context, cli kubernetes.Interface, name string, annotations map[string]*string) error {
+	data, err := AnnotationsPatch(annotations)
+	if err != nil {
+		return err
+	}
+	_, err = cli.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions)
+	return err
+}
+
+// LabelsPatch builds a merge patch of the labels, nil values remove the label.
+func LabelsPatch(labels map[string]*string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": labels,
+		},
+	})
+}
+
+// PatchNodeLabels sets the labels of the node, nil values remove the label.
+func PatchNodeLabels(ctx context.Context, cli kubernetes.Interface, name string, labels map[string]*string) error {
+	data, err := LabelsPatch(labels)
+	if err != nil {
+		return err
+	}
+	_, err = cli.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions)
+	return err
+}
+
+// PatchPodLabels sets the labels of the pod, nil values remove the label.
+func PatchPodLabels(ctx context.Context, cli kubernetes.Interface, namespace, name string, labels map[string]*string) error {
+	data, err := LabelsPatch(labels)
+	if err != nil {
+		return err
+	}
+	_, err = cli.CoreV1().Pods(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions)
+	return err
+}
+
+// SetNodeUnschedulable cordons or uncordons the node.
+func SetNodeUnschedulable(ctx context.Context, cli kubernetes.Interface, name string, unschedulable bool) error {
+	data, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"unschedulable": unschedulable,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cli.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions)
+	return err
+}
+
+// patchNodeTaints replaces the taints with the ones returned by mutate. Taints are an atomic list,
+// so the patch carries the resourceVersion it was computed from and is retried on conflicts.
+func patchNodeTaints(ctx context.Context, cli kubernetes.Interface, name string, mutate func([]corev1.Taint) ([]corev1.Taint, bool)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := cli.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		taints, changed := mutate(node.Spec.Taints)
+		if !changed {
+			return nil
+		}
+		data, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"resourceVersion": node.ResourceVersion,
+			},
+			"spec": map[string]any{
+				"taints": taints,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = cli.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions)
+		return err
+	})
+}
+
+// AddNodeTaint adds the taint to the node if no taint with the same key and effect exists.
+func AddNodeTaint(ctx context.Context, cli kubernetes.Interface, name string, taint corev1.Taint) error {
+	return patchNodeTaints(ctx, cli, name, func(taints []corev1.Taint) ([]corev1.Taint, bool) {
+		for _, t := range taints {
+			if t.MatchTaint(&taint) {
+				return taints, false
+			}
+		}
+		return append(taints, taint), true
+	})
+}
+
+// RemoveNodeTaint removes all the taints with the key from the node.
+func RemoveNodeTaint(ctx context.Context, cli kubernetes.Interface, name, key string) error {
+	return patchNodeTaints(ctx, cli, name, func(taints []corev1.Taint) ([]corev1.Taint, bool) {
+		res := make([]corev1.Taint, 0, len(taints))
+		for _, t := range taints {
+			if t.Key != key {
+				res = append(res, t)
+			}
+		}
+		return res, len(res) != len(taints)
+	})
+}
+
+// PatchNodeCondition sets the condition of the node status, conditions are merged by type so the
+// ones of kubelet and other controllers are kept.
+func PatchNodeCondition(ctx context.Context, cli kubernetes.Interface, name string, condition corev1.NodeCondition) error {
+	data, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"conditions": []corev1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cli.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, data, patchOptions, "status")
+	return err
+}
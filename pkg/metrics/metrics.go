@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry of the kcover metrics, it also has the go runtime, process and workqueue metrics.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	registerWorkqueueMetrics()
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+	Registry.MustRegister(c)
+	return c
+}
+
+func NewGaugeVec(name, help string, labelNames ...string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+	Registry.MustRegister(g)
+	return g
+}
+
+// GaugeFuncVec is a gauge vector whose values are evaluated when scraped.
+type GaugeFuncVec struct {
+	desc *prometheus.Desc
+
+	mu    sync.Mutex
+	funcs map[string]gaugeFunc
+}
+
+type gaugeFunc struct {
+	fn     func() float64
+	values []string
+}
+
+func NewGaugeFuncVec(name, help string, labelNames ...string) *GaugeFuncVec {
+	g := &GaugeFuncVec{
+		desc:  prometheus.NewDesc(name, help, labelNames, nil),
+		funcs: map[string]gaugeFunc{},
+	}
+	Registry.MustRegister(g)
+	return g
+}
+
+// SetFunc makes the gauge of the label values evaluate fn when scraped, it replaces the previous one.
+func (g *GaugeFuncVec) SetFunc(fn func() float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.funcs[strings.Join(values, "\xff")] = gaugeFunc{fn: fn, values: values}
+}
+
+func (g *GaugeFuncVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *GaugeFuncVec) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, f := range g.funcs {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, f.fn(), f.values...)
+	}
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,162 @@
+package nodehealth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonHealthy  = "DiagnosticsPassed"
+	messageHealthy = "no faults reported by kcover diagnostics in the last %v"
+)
+
+var _ events.Recorder = (*conditionRecorder)(nil)
+
+type Options struct {
+	// Interval is how often the condition heartbeat is written
+	Interval time.Duration
+	// HealthyAfter is how long the node must be fault free before the condition turns healthy again
+	HealthyAfter time.Duration
+	// GPUReasons are the reasons of the GPU faults besides the ones of the GPU devices, e.g. the
+	// reasons of the dcgm-exporter rules
+	GPUReasons []string
+}
+
+// conditionRecorder keeps the GPU health node condition up to date with the events recorded by the
+// node diagnostics, then passes the events to the underlying recorder.
+type conditionRecorder struct {
+	events.Recorder
+	client     kubernetes.Interface
+	nodeName   string
+	opts       Options
+	gpuReasons sets.Set[string]
+	stop       chan struct{}
+
+	mu            sync.Mutex
+	lastFault     *events.CollectorEvent
+	lastFaultTime time.Time
+	current       *corev1.NodeCondition
+}
+
+func NewConditionRecorder(cli kubernetes.Interface, nodeName string, opts Options, recorder events.Recorder) events.Recorder {
+	return &conditionRecorder{
+		Recorder:   recorder,
+		client:     cli,
+		nodeName:   nodeName,
+		opts:       opts,
+		gpuReasons: sets.New(opts.GPUReasons...),
+		stop:       make(chan struct{}),
+	}
+}
+
+func (c *conditionRecorder) Start() error {
+	if err := c.Recorder.Start(); err != nil {
+		return err
+	}
+	node, err := c.client.CoreV1().Nodes().Get(context.Background(), c.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get node %s error: %w", c.nodeName, err)
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == constants.GPUHealthyCondition {
+			// keep the transition time and the fault across agent restarts
+			c.current = cond.DeepCopy()
+			if cond.Status == corev1.ConditionFalse {
+				c.lastFault = &events.CollectorEvent{
+					TargetType: events.Node,
+					Name:       c.nodeName,
+					EventType:  events.Error,
+					Reason:     cond.Reason,
+					Message:    cond.Message,
+				}
+				c.lastFaultTime = cond.LastTransitionTime.Time
+			}
+		}
+	}
+	go wait.Until(c.sync, c.opts.Interval, c.stop)
+	return nil
+}
+
+func (c *conditionRecorder) Stop() {
+	close(c.stop)
+	c.Recorder.Stop()
+}
+
+// gpuFault returns whether the event is a fault of a GPU of the node, the other faults of the node
+// do not change the GPU health.
+func (c *conditionRecorder) gpuFault(e events.CollectorEvent) bool {
+	if e.Name != c.nodeName {
+		return false
+	}
+	switch e.TargetType {
+	case events.Device:
+		if isGPU(e.Device) {
+			return true
+		}
+	case events.Node:
+	default:
+		return false
+	}
+	return c.gpuReasons.Has(e.Reason) || strings.HasPrefix(e.Reason, "Xid")
+}
+
+// isGPU returns whether the device is a GPU or MIG UUID.
+func isGPU(device string) bool {
+	return strings.HasPrefix(device, "GPU-") || strings.HasPrefix(device, "MIG-")
+}
+
+func (c *conditionRecorder) RecordEvent(e events.CollectorEvent) error {
+	if c.gpuFault(e) {
+		c.mu.Lock()
+		c.lastFault = &e
+		c.lastFaultTime = time.Now()
+		c.mu.Unlock()
+		c.sync()
+	}
+	return c.Recorder.RecordEvent(e)
+}
+
+func (c *conditionRecorder) sync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := metav1.Now()
+	cond := corev1.NodeCondition{
+		Type:              constants.GPUHealthyCondition,
+		Status:            corev1.ConditionTrue,
+		LastHeartbeatTime: now,
+		Reason:            ReasonHealthy,
+		Message:           fmt.Sprintf(messageHealthy, c.opts.HealthyAfter),
+	}
+	if c.lastFault != nil && time.Since(c.lastFaultTime) < c.opts.HealthyAfter {
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = c.lastFault.Reason
+		if cond.Reason == "" {
+			cond.Reason = events.ReasonError
+		}
+		cond.Message = c.lastFault.Message
+	}
+	cond.LastTransitionTime = now
+	if c.current != nil && c.current.Status == cond.Status {
+		cond.LastTransitionTime = c.current.LastTransitionTime
+	}
+
+	if err := kube.PatchNodeCondition(context.Background(), c.client, c.nodeName, cond); err != nil {
+		klog.Errorf("update condition %s of node %s error: %v", cond.Type, c.nodeName, err)
+		return
+	}
+	c.current = &cond
+}
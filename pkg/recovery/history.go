@@ -0,0 +1,83 @@
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MaxFaults kept in the history of a node, the count includes the dropped ones. It bounds the
+// faults of the quarantine, which are counted in the kept ones.
+const MaxFaults = 20
+
+// Fault is a fault of a node which made kcover cordon it.
+type Fault struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// FaultHistory of a node, kept in its annotation so it survives restarts of kcover.
+type FaultHistory struct {
+	// Count of all the faults of the node
+	Count int `json:"count"`
+	// ClearedAt is when the quarantine was cleared, the faults before it are not counted again
+	ClearedAt *time.Time `json:"clearedAt,omitempty"`
+	// Faults are the latest ones, the oldest first
+	Faults []Fault `json:"faults"`
+}
+
+// Quarantine of the nodes with too many faults, they are only uncordoned after a manual clearance.
+type Quarantine struct {
+	// Faults in the window which quarantine a node, 0 disables the quarantine
+	Faults int
+	Window time.Duration
+}
+
+// NodeFaultHistory reads the history from the annotation of the node.
+func NodeFaultHistory(node *corev1.Node) (FaultHistory, error) {
+	var h FaultHistory
+	data, ok := node.Annotations[constants.FaultHistoryAnnotation]
+	if !ok {
+		return h, nil
+	}
+	if err := json.Unmarshal([]byte(data), &h); err != nil {
+		return h, fmt.Errorf("invalid fault history of node %s: %w", node.Name, err)
+	}
+	return h, nil
+}
+
+// Annotation is the value of the history annotation.
+func (h FaultHistory) Annotation() (string, error) {
+	data, err := json.Marshal(h)
+	return string(data), err
+}
+
+func (h *FaultHistory) Add(f Fault) {
+	h.Count++
+	h.Faults = append(h.Faults, f)
+	if len(h.Faults) > MaxFaults {
+		h.Faults = h.Faults[len(h.Faults)-MaxFaults:]
+	}
+}
+
+// Since counts the faults after the time which are not cleared.
+func (h FaultHistory) Since(t time.Time) int {
+	if h.ClearedAt != nil && h.ClearedAt.After(t) {
+		t = *h.ClearedAt
+	}
+	n := 0
+	for _, f := range h.Faults {
+		if f.Time.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// Exceeds returns whether the history quarantines the node at the time.
+func (q Quarantine) Exceeds(h FaultHistory, now time.Time) bool {
+	return q.Faults > 0 && h.Since(now.Add(-q.Window)) >= q.Faults
+}
@@ -0,0 +1,182 @@
+package recovery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// faultsAt returns a fault at each of the offsets from now.
+func faultsAt(offsets ...time.Duration) []Fault {
+	var faults []Fault
+	for _, o := range offsets {
+		faults = append(faults, Fault{Time: now.Add(o), Reason: "XidError"})
+	}
+	return faults
+}
+
+func TestFaultHistoryAdd(t *testing.T) {
+	tests := []struct {
+		name       string
+		added      int
+		wantKept   int
+		wantOldest time.Duration
+	}{
+		{name: "one", added: 1, wantKept: 1, wantOldest: 0},
+		{name: "max", added: MaxFaults, wantKept: MaxFaults, wantOldest: 0},
+		{name: "truncated", added: MaxFaults + 5, wantKept: MaxFaults, wantOldest: 5 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h FaultHistory
+			for i := 0; i < tt.added; i++ {
+				h.Add(Fault{Time: now.Add(time.Duration(i) * time.Hour), Reason: "XidError"})
+			}
+			if h.Count != tt.added {
+				t.Errorf("count %d, want %d", h.Count, tt.added)
+			}
+			if len(h.Faults) != tt.wantKept {
+				t.Fatalf("kept %d faults, want %d", len(h.Faults), tt.wantKept)
+			}
+			if oldest := h.Faults[0].Time.Sub(now); oldest != tt.wantOldest {
+				t.Errorf("oldest fault at %v, want %v", oldest, tt.wantOldest)
+			}
+			if latest := h.Faults[len(h.Faults)-1].Time.Sub(now); latest != time.Duration(tt.added-1)*time.Hour {
+				t.Errorf("latest fault at %v, want %v", latest, time.Duration(tt.added-1)*time.Hour)
+			}
+		})
+	}
+}
+
+func TestFaultHistoryAnnotation(t *testing.T) {
+	cleared := now.Add(-time.Hour)
+	h := FaultHistory{Count: 3, ClearedAt: &cleared, Faults: faultsAt(-2*time.Hour, -time.Minute)}
+	data, err := h.Annotation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "worker-a800-2",
+		Annotations: map[string]string{constants.FaultHistoryAnnotation: data},
+	}}
+	got, err := NodeFaultHistory(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("got %+v, want %+v", got, h)
+	}
+}
+
+func TestFaultHistorySince(t *testing.T) {
+	cleared := func(o time.Duration) *time.Time {
+		c := now.Add(o)
+		return &c
+	}
+	tests := []struct {
+		name      string
+		faults    []Fault
+		clearedAt *time.Time
+		since     time.Duration
+		want      int
+	}{
+		{name: "empty", since: -time.Hour, want: 0},
+		{name: "in window", faults: faultsAt(-30*time.Minute, -time.Minute), since: -time.Hour, want: 2},
+		{name: "before window", faults: faultsAt(-2*time.Hour, -time.Minute), since: -time.Hour, want: 1},
+		// a fault exactly at the start of the window is not after it
+		{name: "at window start", faults: faultsAt(-time.Hour, -time.Minute), since: -time.Hour, want: 1},
+		{name: "cleared in window", faults: faultsAt(-50*time.Minute, -40*time.Minute, -time.Minute), clearedAt: cleared(-30 * time.Minute), since: -time.Hour, want: 1},
+		{name: "cleared before window", faults: faultsAt(-50*time.Minute, -time.Minute), clearedAt: cleared(-2 * time.Hour), since: -time.Hour, want: 2},
+		{name: "cleared at a fault", faults: faultsAt(-30*time.Minute, -time.Minute), clearedAt: cleared(-30 * time.Minute), since: -time.Hour, want: 1},
+		{name: "cleared after all faults", faults: faultsAt(-30*time.Minute, -time.Minute), clearedAt: cleared(0), since: -time.Hour, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := FaultHistory{Count: len(tt.faults), ClearedAt: tt.clearedAt, Faults: tt.faults}
+			if got := h.Since(now.Add(tt.since)); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuarantineExceeds(t *testing.T) {
+	cleared := now.Add(-10 * time.Minute)
+	tests := []struct {
+		name       string
+		quarantine Quarantine
+		history    FaultHistory
+		want       bool
+	}{
+		{
+			name:       "disabled",
+			quarantine: Quarantine{Faults: 0, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 5, Faults: faultsAt(-4*time.Hour, -3*time.Hour, -2*time.Hour, -time.Hour, -time.Minute)},
+			want:       false,
+		},
+		{
+			name:       "below",
+			quarantine: Quarantine{Faults: 3, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 2, Faults: faultsAt(-2*time.Hour, -time.Minute)},
+			want:       false,
+		},
+		{
+			name:       "reached",
+			quarantine: Quarantine{Faults: 3, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 3, Faults: faultsAt(-3*time.Hour, -2*time.Hour, -time.Minute)},
+			want:       true,
+		},
+		{
+			name:       "outside window",
+			quarantine: Quarantine{Faults: 3, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 3, Faults: faultsAt(-48*time.Hour, -2*time.Hour, -time.Minute)},
+			want:       false,
+		},
+		{
+			name:       "at window start",
+			quarantine: Quarantine{Faults: 3, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 3, Faults: faultsAt(-24*time.Hour, -2*time.Hour, -time.Minute)},
+			want:       false,
+		},
+		{
+			name:       "cleared",
+			quarantine: Quarantine{Faults: 3, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 4, ClearedAt: &cleared, Faults: faultsAt(-3*time.Hour, -2*time.Hour, -time.Hour, -time.Minute)},
+			want:       false,
+		},
+		{
+			name:       "faults after clearance",
+			quarantine: Quarantine{Faults: 2, Window: 24 * time.Hour},
+			history:    FaultHistory{Count: 5, ClearedAt: &cleared, Faults: faultsAt(-3*time.Hour, -2*time.Hour, -time.Hour, -5*time.Minute, -time.Minute)},
+			want:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quarantine.Exceeds(tt.history, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuarantineExceedsTruncated(t *testing.T) {
+	// the faults dropped from the history are not counted, so the quarantine needs at most
+	// MaxFaults of them
+	var h FaultHistory
+	for i := 0; i < MaxFaults+10; i++ {
+		h.Add(Fault{Time: now.Add(-time.Duration(MaxFaults+10-i) * time.Minute), Reason: "XidError"})
+	}
+	if !(Quarantine{Faults: MaxFaults, Window: 24 * time.Hour}).Exceeds(h, now) {
+		t.Errorf("%d kept faults do not quarantine the node", MaxFaults)
+	}
+	if (Quarantine{Faults: MaxFaults + 1, Window: 24 * time.Hour}).Exceeds(h, now) {
+		t.Errorf("dropped faults quarantine the node")
+	}
+}
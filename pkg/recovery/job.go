@@ -13,6 +13,32 @@ import (
 
 var ttlCache = ttlcache.New[string, map[string]string]()
 
+// JobLabels returns the labels of the kubeflow job owning the pod.
+func JobLabels(cli kubernetes.Interface, pod *corev1.Pod) (map[string]string, error) {
+	return getPodRelatedJobLabels(cli, pod)
+}
+
+// jobReference refers to the kubeflow job owning the pod, or the pod itself if it has no owner.
+func jobReference(pod *corev1.Pod) *corev1.ObjectReference {
+	if len(pod.OwnerReferences) < 1 {
+		return &corev1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        pod.UID,
+		}
+	}
+	owner := pod.OwnerReferences[0]
+	return &corev1.ObjectReference{
+		Kind:       owner.Kind,
+		APIVersion: owner.APIVersion,
+		Namespace:  pod.Namespace,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
+
 func getPodRelatedJobLabels(cli kubernetes.Interface, pod *corev1.Pod) (map[string]string, error) {
 	if len(pod.OwnerReferences) < 1 {
 		return nil, fmt.Errorf("pod %s/%s has no owner", pod.Namespace, pod.Name)
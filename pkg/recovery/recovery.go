@@ -3,87 +3,241 @@ package recovery
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/samber/lo"
 
 	"github.com/baizeai/kcover/pkg/constants"
 	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/keymutex"
+	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/baizeai/kcover/pkg/metrics"
 	"github.com/jellydator/ttlcache/v3"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
 
 type RecoveryController struct {
-	client          kubernetes.Interface
-	recorder        events.Recorder
-	stop            chan struct{}
-	restartDuration time.Duration
-	restarts        *ttlcache.Cache[string, time.Time]
+	client    kubernetes.Interface
+	incidents <-chan events.Incident
+	stop      chan struct{}
+	// opts are replaced as a whole by SetOptions
+	opts     atomic.Pointer[Options]
+	restarts *ttlcache.Cache[string, time.Time]
+	// recorder records the actions as events, kcoverctl lists them
+	recorder  record.EventRecorder
+	decisions *decisions
+	// events with these reasons can not be fixed by restarting the job, so they are only notified
+	notifyOnlyReasons sets.Set[string]
+
+	// queue is keyed by incident key, so the same incident is never processed concurrently. A job
+	// incident and the incident of a node running the job may be, jobLocks serialize the recovery
+	// of the job itself.
+	queue    workqueue.RateLimitingInterface
+	jobLocks *keymutex.KeyedMutex
+	workers  int
+	mu       sync.Mutex
+	pending  map[string]events.Incident
+}
+
+// DefaultNotifyOnlyReasons are pod failures which restarting the job can not fix.
+var DefaultNotifyOnlyReasons = []string{
+	events.ReasonErrImagePull,
+	events.ReasonImagePullBackOff,
+	events.ReasonCreateContainerConfigError,
+	events.ReasonRunContainerError,
 }
 
-func NewRecoveryController(cli kubernetes.Interface, recorder events.Recorder) *RecoveryController {
-	return &RecoveryController{
-		client:          cli,
-		recorder:        recorder,
-		stop:            make(chan struct{}),
-		restartDuration: time.Second * 30,
-		restarts:        ttlcache.New[string, time.Time](),
+const maxRetries = 5
+
+// DefaultRestartCooldown is the duration in which a restarted job is not restarted again.
+const DefaultRestartCooldown = 30 * time.Second
+
+// actions of the recovery, they are the values of the action annotation of the events
+const (
+	ActionRestartJob     = "restart-job"
+	ActionCordonNode     = "cordon-node"
+	ActionQuarantineNode = "quarantine-node"
+)
+
+var recoveryActions = metrics.NewCounterVec("kcover_recovery_actions_total",
+	"Number of recovery actions by action and result.", "action", "result")
+
+type Options struct {
+	// Workers process the incidents of different jobs and nodes in parallel
+	Workers int
+	// RestartCooldown is the duration in which a restarted job is not restarted again
+	RestartCooldown time.Duration
+	Quarantine      Quarantine
+}
+
+var DefaultOptions = Options{
+	Workers:         4,
+	RestartCooldown: DefaultRestartCooldown,
+	Quarantine:      Quarantine{Faults: 3, Window: 7 * 24 * time.Hour},
+}
+
+func NewRecoveryController(cli kubernetes.Interface, incidents <-chan events.Incident, opts Options) *RecoveryController {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
 	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: cli.CoreV1().Events(""),
+	})
+	r := &RecoveryController{
+		client:            cli,
+		incidents:         incidents,
+		stop:              make(chan struct{}),
+		restarts:          ttlcache.New[string, time.Time](),
+		recorder:          eventBroadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "kcover"}),
+		decisions:         newDecisions(),
+		notifyOnlyReasons: sets.New(DefaultNotifyOnlyReasons...),
+		queue: workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{
+			Name: "recovery",
+		}),
+		workers:  workers,
+		pending:  map[string]events.Incident{},
+		jobLocks: keymutex.New(),
+	}
+	r.opts.Store(&opts)
+	return r
 }
 
-func (r *RecoveryController) onPodError(namespace, name string) {
+func (r *RecoveryController) onPodError(namespace, name, cause string) error {
 	pod, err := r.client.CoreV1().Pods(namespace).Get(context.Background(), name, metav1.GetOptions{})
 	if err != nil {
-		klog.Errorf("get pod %s/%s error events error: %v", namespace, name, err)
-		return
+		if apierrors.IsNotFound(err) {
+			d := &Decision{Key: fmt.Sprintf("pod/%s/%s", namespace, name), Cause: cause, Time: time.Now(), Outcome: OutcomeSkipped}
+			d.step("pod exists", false, "pod %s/%s has gone", namespace, name)
+			r.finishDecision(d, nil, nil)
+			klog.Infof("pod %s/%s has gone, skip it", namespace, name)
+			return nil
+		}
+		return fmt.Errorf("get pod %s/%s error: %w", namespace, name, err)
+	}
+	_, err = r.recoverPodJob(pod, cause)
+	return err
+}
+
+// recoverPodJob restarts the job of the pod if the pod or its job enables recovery, the returned
+// decision records why it did or did not.
+func (r *RecoveryController) recoverPodJob(pod *corev1.Pod, cause string) (d *Decision, err error) {
+	namespace, name := pod.Namespace, pod.Name
+	jobLabel, hasJob := pod.Labels[constants.KubeflowJobLabel]
+	d = &Decision{Key: fmt.Sprintf("pod/%s/%s", namespace, name), Cause: cause, Time: time.Now()}
+	if hasJob {
+		d.Key = fmt.Sprintf("job/%s/%s", namespace, jobLabel)
+		defer r.jobLocks.Lock(d.Key)()
 	}
-	if pod.Labels[constants.EnabledRecoveryLabel] != constants.True {
+	defer func() {
+		r.finishDecision(d, jobReference(pod), err)
+	}()
+
+	if pod.Labels[constants.EnabledRecoveryLabel] == constants.True {
+		d.step("recovery label", true, "pod %s has %s=true", name, constants.EnabledRecoveryLabel)
+	} else {
 		ls, err := getPodRelatedJobLabels(r.client, pod)
 		if err != nil {
-			klog.Errorf("get pod %s/%s related job labels error: %v", namespace, name, err)
-			return
+			d.step("recovery label", false, "get the labels of the owner job error: %v", err)
+			return d, fmt.Errorf("get pod %s/%s related job labels error: %w", namespace, name, err)
 		}
 		if ls[constants.EnabledRecoveryLabel] != constants.True {
+			d.step("recovery label", false, "neither pod %s nor its owner job has %s=true", name, constants.EnabledRecoveryLabel)
+			d.Outcome = OutcomeSkipped
 			klog.Infof("pod %s/%s or its owner job has no recovery label", namespace, name)
-			return
+			return d, nil
 		}
+		d.step("recovery label", true, "the owner job has %s=true", constants.EnabledRecoveryLabel)
 	}
-	if jobLabel, ok := pod.Labels[constants.KubeflowJobLabel]; !ok {
+	if !hasJob {
+		d.step("job label", false, "pod %s has no %s label", name, constants.KubeflowJobLabel)
+		d.Outcome = OutcomeSkipped
 		klog.Warningf("pod %s/%s has no job label", namespace, name)
+		return d, nil
+	}
+	d.step("job label", true, "%s=%s", constants.KubeflowJobLabel, jobLabel)
+	if pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
+		d.step("restart policy", false, "pod %s has RestartPolicyNever", name)
+		d.Outcome = OutcomeSkipped
+		klog.Warningf("pod %s/%s has RestartPolicyNever, will not restart", namespace, name)
+		return d, nil
+	}
+	d.step("restart policy", true, "%s", pod.Spec.RestartPolicy)
+
+	key := fmt.Sprintf("%s/%s", namespace, jobLabel)
+	cooldown := r.restartCooldown()
+	tv, restarted := r.restarts.GetOrSet(key, time.Now(), ttlcache.WithTTL[string, time.Time](cooldown))
+	if restarted {
+		d.step("cooldown", false, "restarted at %s, will not restart again in %v", tv.Value().Format(time.RFC3339), cooldown)
+		d.Outcome = OutcomeSkipped
+		klog.Infof("job %s/%s has been restarted at %v, will not restart again in %v", namespace, jobLabel, tv.Value(), cooldown)
+		return d, nil
+	}
+	d.step("cooldown", true, "not restarted in the last %v", cooldown)
+	if err := r.restartJob(context.Background(), namespace, jobLabel); err != nil {
+		// allow the retry to restart it
+		r.restarts.Delete(key)
+		d.step("restart", false, "%v", err)
+		return d, err
+	}
+	d.step("restart", true, "deleted the pods of the job")
+	d.Outcome = OutcomeRestarted
+	r.recordAction(jobReference(pod), ActionRestartJob, "RestartedJob",
+		fmt.Sprintf("restarted the pods of job %s/%s because of %s", namespace, jobLabel, cause))
+	go func() {
+		<-time.After(cooldown - time.Second)
+		r.restarts.Delete(key) //
+	}()
+	return d, nil
+}
+
+// finishDecision keeps the decision, the skipped and failed recoveries of jobs are recorded as
+// events of the job as well.
+func (r *RecoveryController) finishDecision(d *Decision, ref *corev1.ObjectReference, err error) {
+	if err != nil {
+		d.Outcome = OutcomeFailed
+		d.Error = err.Error()
+	}
+	r.decisions.add(*d)
+	if ref == nil {
 		return
-	} else {
-		if pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
-			klog.Warningf("pod %s/%s has RestartPolicyNever, will not restart", namespace, name)
-			return
-		}
-		key := fmt.Sprintf("%s/%s", namespace, jobLabel)
-		tv := r.restarts.Get(key)
-		if tv != nil {
-			klog.Infof("job %s/%s has been restarted at %v, will not restart again in %v", namespace, jobLabel, tv.Value(), r.restartDuration)
-			return
-		}
-		now := time.Now()
-		r.restarts.Set(key, now, r.restartDuration) // only restart once in 60 seconds
-		r.restartJob(context.Background(), namespace, jobLabel)
-		go func() {
-			<-time.After(r.restartDuration - time.Second)
-			r.restarts.Delete(key) //
-		}()
+	}
+	switch d.Outcome {
+	case OutcomeSkipped:
+		r.recorder.AnnotatedEventf(ref, map[string]string{constants.DecisionAnnotation: d.Outcome}, corev1.EventTypeNormal,
+			"RecoverySkipped", "not restarted after %s, %s", d.Cause, d.Summary())
+	case OutcomeFailed:
+		r.recorder.AnnotatedEventf(ref, map[string]string{constants.DecisionAnnotation: d.Outcome}, corev1.EventTypeWarning,
+			"RecoveryFailed", "restart after %s failed: %s", d.Cause, d.Summary())
 	}
 }
 
-func (r *RecoveryController) restartJob(ctx context.Context, namespace, name string) {
+func (r *RecoveryController) restartJob(ctx context.Context, namespace, name string) error {
 	err := r.client.CoreV1().Pods(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("%s=%s", constants.KubeflowJobLabel, name),
 	})
 	if err != nil {
-		klog.Errorf("restart job %s/%s error: %v", namespace, name, err)
-	} else {
-		klog.Infof("restart job %s/%s successfully", namespace, name)
+		recoveryActions.WithLabelValues(ActionRestartJob, "error").Inc()
+		return fmt.Errorf("restart job %s/%s error: %w", namespace, name, err)
 	}
+	recoveryActions.WithLabelValues(ActionRestartJob, "success").Inc()
+	klog.Infof("restart job %s/%s successfully", namespace, name)
+	return nil
 }
 
 type nsName struct {
@@ -91,26 +245,37 @@ type nsName struct {
 	name string
 }
 
-func (r *RecoveryController) onNodeError(name string) {
+func (r *RecoveryController) onNodeError(name, reason string) (err error) {
+	d := &Decision{Key: "node/" + name, Cause: reason, Time: time.Now()}
+	defer func() {
+		r.finishDecision(d, nil, err)
+	}()
 	node, err := r.client.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
 	if err != nil {
-		klog.Errorf("get node %s error: %v", name, err)
-		return
+		if apierrors.IsNotFound(err) {
+			d.step("node exists", false, "node %s has gone", name)
+			d.Outcome = OutcomeSkipped
+			klog.Infof("node %s has gone, skip it", name)
+			return nil
+		}
+		return fmt.Errorf("get node %s error: %w", name, err)
 	}
 	if node.Spec.Unschedulable {
+		d.step("node schedulable", false, "node %s is already unschedulable", name)
+		d.Outcome = OutcomeSkipped
 		klog.Infof("the node %s status has been set to unschedulable", name)
-		return
+		return nil
 	}
+	d.step("node schedulable", true, "node %s is schedulable", name)
 	// query jobs
 	pods, err := r.client.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
 		LabelSelector: constants.KubeflowJobLabel,
 		FieldSelector: fmt.Sprintf("spec.nodeName=%s", name),
 	})
 	if err != nil {
-		klog.Errorf("fetch pods list for node %s error: %v", node, err)
-		return
+		return fmt.Errorf("fetch pods list for node %s error: %w", name, err)
 	}
-	jobs := map[nsName]struct{}{}
+	jobs := map[nsName]corev1.Pod{}
 	lo.ForEach(pods.Items, func(pod corev1.Pod, index int) {
 		if jobLabel, ok := pod.Labels[constants.KubeflowJobLabel]; !ok {
 			return
@@ -118,45 +283,237 @@ func (r *RecoveryController) onNodeError(name string) {
 			jobs[nsName{
 				ns:   pod.Namespace,
 				name: jobLabel,
-			}] = struct{}{}
+			}] = pod
 		}
 	})
-	lo.ForEach(lo.Keys(jobs), func(item nsName, index int) {
-		r.onPodError(item.ns, item.name)
-	})
-	node.Spec.Unschedulable = true
-	_, err = r.client.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	d.step("jobs on node", true, "%d jobs", len(jobs))
+	var errs []error
+	for _, pod := range jobs {
+		jd, err := r.recoverPodJob(&pod, fmt.Sprintf("fault of node %s: %s", name, reason))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		d.step("recover "+jd.Key, err == nil, "%s, %s", jd.Outcome, jd.Summary())
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	quarantine, err := r.cordonNode(context.Background(), node, reason)
 	if err != nil {
-		klog.Errorf("update node %s to unschedulable error: %v", name, err)
+		recoveryActions.WithLabelValues(ActionCordonNode, "error").Inc()
+		d.step("cordon", false, "%v", err)
+		return fmt.Errorf("cordon node %s error: %w", name, err)
+	}
+	recoveryActions.WithLabelValues(ActionCordonNode, "success").Inc()
+	d.step("cordon", true, "tainted %s and cordoned the node", constants.UnhealthyTaintKey)
+	d.Outcome = OutcomeCordoned
+	ref := &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: name, UID: node.UID}
+	r.recordAction(ref, ActionCordonNode, "CordonedNode", fmt.Sprintf("cordoned node %s because of %s", name, reason))
+	klog.Infof("node %s has been set to unschedulable", name)
+	if quarantine == "" {
+		return nil
+	}
+	if err := kube.PatchNodeLabels(context.Background(), r.client, name, map[string]*string{
+		constants.QuarantinedLabel: lo.ToPtr(constants.True),
+	}); err != nil {
+		recoveryActions.WithLabelValues(ActionQuarantineNode, "error").Inc()
+		d.step("quarantine", false, "%v", err)
+		return fmt.Errorf("quarantine node %s error: %w", name, err)
+	}
+	recoveryActions.WithLabelValues(ActionQuarantineNode, "success").Inc()
+	d.step("quarantine", true, "%s, labelled %s", quarantine, constants.QuarantinedLabel)
+	d.Outcome = OutcomeQuarantined
+	r.recordAction(ref, ActionQuarantineNode, "QuarantinedNode", fmt.Sprintf("quarantined node %s: %s", name, quarantine))
+	klog.Warningf("node %s has been quarantined: %s", name, quarantine)
+	return nil
+}
+
+// recordAction records the action as a normal event of the object.
+func (r *RecoveryController) recordAction(ref *corev1.ObjectReference, action, reason, message string) {
+	r.recorder.AnnotatedEventf(ref, map[string]string{constants.ActionAnnotation: action}, corev1.EventTypeNormal, reason, message)
+}
+
+// cordonNode marks the node unschedulable and taints it, the annotations record why kcover did it
+// and the fault in the history of the node. It returns why the node is quarantined, empty if the
+// node has not exceeded the faults of the quarantine.
+func (r *RecoveryController) cordonNode(ctx context.Context, node *corev1.Node, reason string) (string, error) {
+	name := node.Name
+	now := time.Now().UTC().Truncate(time.Second)
+	at := now.Format(time.RFC3339)
+	if err := kube.PatchNodeAnnotations(ctx, r.client, name, map[string]*string{
+		constants.CordonedAtAnnotation:   &at,
+		constants.CordonReasonAnnotation: &reason,
+	}); err != nil {
+		return "", err
+	}
+	if err := kube.AddNodeTaint(ctx, r.client, name, corev1.Taint{
+		Key:    constants.UnhealthyTaintKey,
+		Value:  constants.True,
+		Effect: corev1.TaintEffectNoSchedule,
+	}); err != nil {
+		return "", err
+	}
+	if err := kube.SetNodeUnschedulable(ctx, r.client, name, true); err != nil {
+		return "", err
+	}
+
+	// the fault is added only once the node is cordoned, a retry of a failed cordon would add
+	// it again
+	history, err := NodeFaultHistory(node)
+	if err != nil {
+		// a broken history must not block the cordon
+		klog.Warningf("%v, starting a new one", err)
+		history = FaultHistory{}
+	}
+	history.Add(Fault{Time: now, Reason: reason})
+	data, err := history.Annotation()
+	if err != nil {
+		return "", err
+	}
+	annotations := map[string]*string{
+		constants.FaultHistoryAnnotation: &data,
+	}
+	var quarantine string
+	if q := r.opts.Load().Quarantine; q.Exceeds(history, now) {
+		quarantine = fmt.Sprintf("%d faults in %v", history.Since(now.Add(-q.Window)), q.Window)
+		annotations[constants.QuarantineReasonAnnotation] = &quarantine
+	}
+	return quarantine, kube.PatchNodeAnnotations(ctx, r.client, name, annotations)
+}
+
+// enqueue merges the incident into the pending one of the same key, which has not been processed yet.
+func (r *RecoveryController) enqueue(in events.Incident) {
+	key := in.Key()
+	r.mu.Lock()
+	if pending, ok := r.pending[key]; ok {
+		pending.Events = append(pending.Events, in.Events...)
+		pending.LastSeen = in.LastSeen
+		if in.EventType == events.Error {
+			pending.EventType = events.Error
+		}
+		in = pending
+	}
+	r.pending[key] = in
+	r.mu.Unlock()
+	r.queue.Add(key)
+}
+
+func (r *RecoveryController) runWorker() {
+	for r.processNextItem() {
 	}
 }
 
-func (r *RecoveryController) onEvent(e events.CollectorEvent) {
-	klog.Infof("recover controller received event: %+v", e)
-	switch e.TargetType {
-	case events.Pod:
-		if e.EventType == events.Error {
-			r.onPodError(e.Namespace, e.Name)
+func (r *RecoveryController) processNextItem() bool {
+	item, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(item)
+	key := item.(string)
+
+	r.mu.Lock()
+	in, ok := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+	if !ok {
+		r.queue.Forget(item)
+		return true
+	}
+
+	err := r.onIncident(in)
+	if err == nil {
+		r.queue.Forget(item)
+		return true
+	}
+	if r.queue.NumRequeues(item) < maxRetries {
+		klog.Warningf("recover incident %s error, will retry: %v", key, err)
+		r.mu.Lock()
+		if _, ok := r.pending[key]; !ok {
+			r.pending[key] = in
 		}
+		r.mu.Unlock()
+		r.queue.AddRateLimited(item)
+		return true
+	}
+	klog.Errorf("recover incident %s error, giving up after %d retries: %v", key, maxRetries, err)
+	r.queue.Forget(item)
+	return true
+}
+
+func (r *RecoveryController) onIncident(in events.Incident) error {
+	klog.Infof("recover controller received incident %s with %d events: %+v", in.Key(), len(in.Events), in.Events)
+	switch in.TargetType {
+	case events.Job, events.Pod:
+		e, ok := lo.Find(in.Events, func(e events.CollectorEvent) bool {
+			return e.EventType == events.Error && !r.notifyOnlyReasons.Has(e.Reason)
+		})
+		if !ok {
+			r.notifyOnly(in, "the incident has no Error events which restarting the job can fix")
+			return nil
+		}
+		// one pod is enough to find the job and restart all of its pods
+		return r.onPodError(e.Namespace, e.Name, fmt.Sprintf("%s event %s of pod %s/%s", e.EventType, e.Reason, e.Namespace, e.Name))
 	case events.Node:
-		r.onNodeError(e.Name)
+		// Warning events of nodes, e.g. NodeImagePullFailures, never cordon the node
+		if in.EventType != events.Error {
+			r.notifyOnly(in, "the incident has no Error events")
+			return nil
+		}
+		return r.onNodeError(in.Name, incidentReason(in))
 	default:
-		klog.Errorf("unsupported target type: %s", e.TargetType)
+		klog.Errorf("unsupported target type: %s", in.TargetType)
 	}
+	return nil
+}
+
+// notifyOnly records the decision of the incident which is only notified.
+func (r *RecoveryController) notifyOnly(in events.Incident, why string) {
+	d := &Decision{Key: in.Key(), Cause: incidentReason(in), Time: time.Now(), Outcome: OutcomeNotified}
+	d.step("error events", false, "%s", why)
+	r.finishDecision(d, nil, nil)
+	klog.Infof("incident %s: %s, notify only", in.Key(), why)
+}
+
+// incidentReason summarizes the reasons of the incident events.
+func incidentReason(in events.Incident) string {
+	reasons := sets.New[string]()
+	for _, e := range in.Events {
+		if e.Reason != "" {
+			reasons.Insert(e.Reason)
+		}
+	}
+	if reasons.Len() == 0 {
+		return events.ReasonError
+	}
+	return strings.Join(sets.List(reasons), ",")
+}
+
+func (r *RecoveryController) restartCooldown() time.Duration {
+	return r.opts.Load().RestartCooldown
+}
+
+// SetOptions applies the options to the running controller, the workers can not be changed
+// once started.
+func (r *RecoveryController) SetOptions(opts Options) {
+	r.opts.Store(&opts)
 }
 
 func (r *RecoveryController) Start() error {
-	if r.recorder == nil {
-		return fmt.Errorf("recorder is nil")
+	if r.incidents == nil {
+		return fmt.Errorf("incidents channel is nil")
 	}
 	go func() {
-		for e := range r.recorder.EventChan() {
-			r.onEvent(e)
+		for in := range r.incidents {
+			r.enqueue(in)
 		}
 	}()
+	for i := 0; i < r.workers; i++ {
+		go wait.Until(r.runWorker, time.Second, r.stop)
+	}
 	return nil
 }
 
 func (r *RecoveryController) Stop() {
 	close(r.stop)
+	r.queue.ShutDown()
 }
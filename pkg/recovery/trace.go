@@ -0,0 +1,184 @@
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// DebugPath serves the recovery decisions of the leader.
+const DebugPath = "/debug/recovery"
+
+// outcomes of the decisions
+const (
+	OutcomeRestarted   = "restarted"
+	OutcomeCordoned    = "cordoned"
+	OutcomeQuarantined = "quarantined"
+	OutcomeNotified    = "notified"
+	OutcomeSkipped     = "skipped"
+	OutcomeFailed      = "failed"
+)
+
+const (
+	decisionTTL     = time.Hour
+	maxDecisionKeys = 10000
+	maxDecisions    = 20
+)
+
+// Step is a condition evaluated by the recovery controller.
+type Step struct {
+	Check  string `json:"check"`
+	Result string `json:"result"`
+	Passed bool   `json:"passed"`
+}
+
+// Decision records how the recovery controller handled a fault of a job, pod or node.
+type Decision struct {
+	// Key is job/<namespace>/<name>, pod/<namespace>/<name> or node/<name>
+	Key     string    `json:"key"`
+	Cause   string    `json:"cause"`
+	Time    time.Time `json:"time"`
+	Steps   []Step    `json:"steps"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (d *Decision) step(check string, passed bool, format string, args ...any) {
+	d.Steps = append(d.Steps, Step{Check: check, Result: fmt.Sprintf(format, args...), Passed: passed})
+}
+
+// Summary is the last failed check of the decision, or the outcome if all passed.
+func (d *Decision) Summary() string {
+	for i := len(d.Steps) - 1; i >= 0; i-- {
+		if !d.Steps[i].Passed {
+			return fmt.Sprintf("%s: %s", d.Steps[i].Check, d.Steps[i].Result)
+		}
+	}
+	if d.Error != "" {
+		return d.Error
+	}
+	return d.Outcome
+}
+
+// decisions keeps the recent decisions of each key.
+type decisions struct {
+	mu    sync.Mutex
+	cache *ttlcache.Cache[string, []Decision]
+}
+
+func newDecisions() *decisions {
+	return &decisions{
+		cache: ttlcache.New[string, []Decision](
+			ttlcache.WithTTL[string, []Decision](decisionTTL),
+			ttlcache.WithCapacity[string, []Decision](maxDecisionKeys),
+		),
+	}
+}
+
+func (s *decisions) add(d Decision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Decision
+	if item := s.cache.Get(d.Key); item != nil {
+		list = item.Value()
+	}
+	list = append(list, d)
+	if len(list) > maxDecisions {
+		list = list[len(list)-maxDecisions:]
+	}
+	s.cache.Set(d.Key, list, ttlcache.DefaultTTL)
+}
+
+func (s *decisions) get(key string) []Decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item := s.cache.Get(key); item != nil {
+		return append([]Decision(nil), item.Value()...)
+	}
+	return nil
+}
+
+// latest returns the last decision of every key.
+func (s *decisions) latest() []Decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Decision
+	for _, item := range s.cache.Items() {
+		if item.IsExpired() || len(item.Value()) == 0 {
+			continue
+		}
+		res = append(res, item.Value()[len(item.Value())-1])
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Time.After(res[j].Time)
+	})
+	return res
+}
+
+// Decisions returns the recent decisions of the key, oldest first.
+func (r *RecoveryController) Decisions(key string) []Decision {
+	return r.decisions.get(key)
+}
+
+// DebugHandler serves the decisions of the recovery controller of the leader.
+type DebugHandler struct {
+	mu  sync.RWMutex
+	rec *RecoveryController
+}
+
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{}
+}
+
+// SetController sets the controller whose decisions are served, nil when not leading.
+func (h *DebugHandler) SetController(rec *RecoveryController) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rec = rec
+}
+
+// ServeHTTP answers ?job=<namespace>/<name>, ?pod=<namespace>/<name>, ?node=<name> or ?key=<key>,
+// all the keys with their last decision are listed without a query.
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.RLock()
+	rec := h.rec
+	h.mu.RUnlock()
+	if rec == nil {
+		http.Error(w, "not leader", http.StatusServiceUnavailable)
+		return
+	}
+	q := req.URL.Query()
+	var key string
+	switch {
+	case q.Get("key") != "":
+		key = q.Get("key")
+	case q.Get("job") != "":
+		key = "job/" + q.Get("job")
+	case q.Get("pod") != "":
+		key = "pod/" + q.Get("pod")
+	case q.Get("node") != "":
+		key = "node/" + q.Get("node")
+	}
+
+	var res any
+	if key == "" {
+		res = rec.decisions.latest()
+	} else {
+		list := rec.Decisions(strings.TrimSuffix(key, "/"))
+		if len(list) == 0 {
+			http.Error(w, fmt.Sprintf("no decisions of %s in the last %v", key, decisionTTL), http.StatusNotFound)
+			return
+		}
+		res = list
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(res)
+}
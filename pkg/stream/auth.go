@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/baizeai/kcover/pkg/events"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultAudience of the service account tokens the agents authenticate with
+	DefaultAudience = "kcover"
+	// DefaultTokenFile is where the agent pods mount their projected service account token
+	DefaultTokenFile = "/var/run/secrets/kcover/token"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+	// extra info of the tokens bound to pods
+	nodeNameExtra = "authentication.kubernetes.io/node-name"
+	podNameExtra  = "authentication.kubernetes.io/pod-name"
+	podUIDExtra   = "authentication.kubernetes.io/pod-uid"
+)
+
+// caller is the agent of a stream, it may only report the faults of its node and the pods on it.
+type caller struct {
+	serviceAccount string
+	node           string
+}
+
+// authError is an error of the authentication with the status of the response.
+type authError struct {
+	status int
+	msg    string
+}
+
+func (e *authError) Error() string {
+	return e.msg
+}
+
+func unauthorized(format string, args ...any) error {
+	return &authError{status: http.StatusUnauthorized, msg: fmt.Sprintf(format, args...)}
+}
+
+func forbidden(format string, args ...any) error {
+	return &authError{status: http.StatusForbidden, msg: fmt.Sprintf(format, args...)}
+}
+
+// authenticate reviews the bearer token of the request, it must be the pod bound token of an
+// allowed service account.
+func (s *Server) authenticate(ctx context.Context, r *http.Request) (*caller, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, unauthorized("bearer token is required")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if s.opts.Audience != "" {
+		review.Spec.Audiences = []string{s.opts.Audience}
+	}
+	res, err := s.client.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("review token error: %w", err)
+	}
+	if !res.Status.Authenticated {
+		return nil, unauthorized("invalid token: %s", res.Status.Error)
+	}
+	user := res.Status.User
+	sa, ok := strings.CutPrefix(user.Username, serviceAccountPrefix)
+	if !ok || !s.serviceAccounts.Has(sa) {
+		return nil, forbidden("user %s is not allowed to stream events", user.Username)
+	}
+	c := &caller{serviceAccount: sa}
+	if node := user.Extra[nodeNameExtra]; len(node) == 1 {
+		c.node = node[0]
+		return c, nil
+	}
+	// the node name is only bound to the tokens since kubernetes 1.30, find it by the pod
+	podName, podUID := user.Extra[podNameExtra], user.Extra[podUIDExtra]
+	if len(podName) != 1 || len(podUID) != 1 {
+		return nil, forbidden("token of %s is not bound to a pod", user.Username)
+	}
+	namespace, _, _ := strings.Cut(sa, ":")
+	pod, err := s.client.CoreV1().Pods(namespace).Get(ctx, podName[0], metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get pod %s/%s of the token error: %w", namespace, podName[0], err)
+	}
+	if pod.UID != types.UID(podUID[0]) || pod.Spec.NodeName == "" {
+		return nil, forbidden("pod %s/%s of the token has gone", namespace, podName[0])
+	}
+	c.node = pod.Spec.NodeName
+	return c, nil
+}
+
+// authorize checks that the event is about the node of the caller or a pod on it.
+func (s *Server) authorize(ctx context.Context, c *caller, env Envelope) error {
+	if env.Node != c.node {
+		return fmt.Errorf("agent of node %s can not send events of node %s", c.node, env.Node)
+	}
+	e := env.Entry.Event
+	switch e.TargetType {
+	case events.Node, events.Device:
+		if e.Name != c.node {
+			return fmt.Errorf("agent of node %s can not report faults of node %s", c.node, e.Name)
+		}
+	case events.Pod:
+		pod, err := s.client.CoreV1().Pods(e.Namespace).Get(ctx, e.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get pod %s/%s error: %w", e.Namespace, e.Name, err)
+		}
+		if pod.Spec.NodeName != c.node {
+			return fmt.Errorf("agent of node %s can not report faults of pod %s/%s on node %q", c.node, e.Namespace, e.Name, pod.Spec.NodeName)
+		}
+	default:
+		return fmt.Errorf("agent can not report faults of %s", e.TargetType)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+var _ events.Recorder = (*streamRecorder)(nil)
+
+type Options struct {
+	// ControllerAddr is the base url of the controller, e.g. http://kcover-controller.kcover-system:8090
+	ControllerAddr string
+	SpoolDir       string
+	MaxSpooled     int
+	// FallbackAfter is how long an event may wait for the acknowledgement before it is
+	// recorded by the fallback recorder, it should be well below the max event age of the controller.
+	FallbackAfter time.Duration
+	// TokenFile is the service account token authenticating the agent, it is read by every session
+	// as the projected tokens are rotated
+	TokenFile string
+}
+
+// streamRecorder pushes the events to the controller through a long-lived stream and falls back
+// to another recorder, normally the kubernetes events one, when the controller is unreachable.
+type streamRecorder struct {
+	opts     Options
+	node     string
+	spool    *Spool
+	fallback events.Recorder
+	client   *http.Client
+	notify   chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// inflight are the entries sent by the current session and not yet acknowledged
+	mu       sync.Mutex
+	inflight map[string]struct{}
+}
+
+func NewStreamRecorder(nodeName string, opts Options, fallback events.Recorder) (events.Recorder, error) {
+	if fallback == nil {
+		return nil, fmt.Errorf("fallback recorder can not be nil")
+	}
+	spool, err := NewSpool(opts.SpoolDir, opts.MaxSpooled)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &streamRecorder{
+		opts:     opts,
+		node:     nodeName,
+		spool:    spool,
+		fallback: fallback,
+		client:   &http.Client{},
+		notify:   make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		inflight: map[string]struct{}{},
+	}, nil
+}
+
+func newBackoff() wait.Backoff {
+	return wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.2, Steps: 6, Cap: 30 * time.Second}
+}
+
+func (s *streamRecorder) Start() error {
+	if err := s.fallback.Start(); err != nil {
+		return err
+	}
+	go func() {
+		backoff := newBackoff()
+		for s.ctx.Err() == nil {
+			established, err := s.session()
+			if s.ctx.Err() != nil {
+				return
+			}
+			if established {
+				// only the failures to reconnect back off further
+				backoff = newBackoff()
+			}
+			klog.Warningf("events stream to %s closed: %v", s.opts.ControllerAddr, err)
+			select {
+			case <-time.After(backoff.Step()):
+			case <-s.ctx.Done():
+			}
+		}
+	}()
+	go wait.Until(s.fallbackStale, 5*time.Second, s.ctx.Done())
+	return nil
+}
+
+func (s *streamRecorder) Stop() {
+	s.cancel()
+	s.fallback.Stop()
+}
+
+func (s *streamRecorder) RecordEvent(e events.CollectorEvent) error {
+	if _, err := s.spool.Put(e); err != nil {
+		klog.Errorf("spool event %+v error, record it by fallback: %v", e, err)
+		return s.fallback.RecordEvent(e)
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *streamRecorder) EventChan() <-chan events.CollectorEvent {
+	return s.fallback.EventChan()
+}
+
+// fallbackStale records the events which have not been acknowledged in time by the fallback recorder,
+// the ones in flight on the current session are left to its acknowledgement.
+func (s *streamRecorder) fallbackStale() {
+	entries, err := s.spool.List()
+	if err != nil {
+		klog.Errorf("list spooled events error: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if time.Since(entry.Time) < s.opts.FallbackAfter {
+			return
+		}
+		// claim the entry so that the session does not send it meanwhile
+		if !s.claim(entry.ID) {
+			continue
+		}
+		klog.Infof("event %s is not acknowledged in %v, record it by fallback", entry.ID, s.opts.FallbackAfter)
+		if err := s.fallback.RecordEvent(entry.Event); err != nil {
+			klog.Errorf("fallback record event %+v error: %v", entry.Event, err)
+		} else {
+			s.spool.Remove(entry.ID)
+		}
+		s.release(entry.ID)
+	}
+}
+
+// claim marks the entry in flight, it returns false if it already is.
+func (s *streamRecorder) claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.inflight[id]; ok {
+		return false
+	}
+	s.inflight[id] = struct{}{}
+	return true
+}
+
+func (s *streamRecorder) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inflight, id)
+}
+
+func (s *streamRecorder) token() (string, error) {
+	if s.opts.TokenFile == "" {
+		return "", nil
+	}
+	bs, err := os.ReadFile(s.opts.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read token error: %w", err)
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// session sends the spooled events through one stream until it fails, it returns whether the
+// stream was established.
+func (s *streamRecorder) session() (bool, error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	token, err := s.token()
+	if err != nil {
+		return false, err
+	}
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.opts.ControllerAddr, "/")+Path, pr)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// sent are the entries in flight on this session, the ones which are not acknowledged are
+	// released for the next session or the fallback
+	var mu sync.Mutex
+	sent := map[string]struct{}{}
+	done := make(chan struct{})
+	defer func() {
+		// wait for the sender so that it claims no more entries
+		cancel()
+		pw.Close()
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		for id := range sent {
+			s.release(id)
+		}
+	}()
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(pw)
+		t := time.NewTicker(10 * time.Second)
+		defer t.Stop()
+		for {
+			entries, err := s.spool.List()
+			if err != nil {
+				klog.Errorf("list spooled events error: %v", err)
+			}
+			for _, entry := range entries {
+				if !s.claim(entry.ID) {
+					continue
+				}
+				mu.Lock()
+				sent[entry.ID] = struct{}{}
+				mu.Unlock()
+				if err := enc.Encode(Envelope{Node: s.node, Entry: entry}); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			select {
+			case <-s.notify:
+			case <-t.C:
+			case <-ctx.Done():
+				pw.Close()
+				return
+			}
+		}
+	}()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		pw.CloseWithError(err)
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(bs)))
+	}
+	klog.Infof("events stream to %s established", s.opts.ControllerAddr)
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ack Ack
+		if err := dec.Decode(&ack); err != nil {
+			return true, err
+		}
+		if ack.OK {
+			s.spool.Remove(ack.ID)
+		} else {
+			// it will be sent again or recorded by the fallback
+			klog.Warningf("event %s is rejected by the controller: %s", ack.ID, ack.Error)
+		}
+		mu.Lock()
+		delete(sent, ack.ID)
+		mu.Unlock()
+		s.release(ack.ID)
+	}
+}
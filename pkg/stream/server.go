@@ -0,0 +1,188 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/baizeai/kcover/pkg/runner"
+	"github.com/jellydator/ttlcache/v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const Path = "/v1/events"
+
+// Envelope is one line of the request stream sent by the agents.
+type Envelope struct {
+	Node  string     `json:"node"`
+	Entry SpoolEntry `json:"entry"`
+}
+
+// Ack is one line of the response stream, acknowledging the envelope with the same id.
+type Ack struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var streamedEvents = metrics.NewCounterVec("kcover_stream_events_total",
+	"Number of events received from the agents stream by result.", "result")
+
+type ServerOptions struct {
+	// MaxEventAge of the accepted events, the older ones are acknowledged but dropped
+	MaxEventAge time.Duration
+	// Audience of the agent tokens, empty accepts the tokens of the kubernetes api
+	Audience string
+	// ServiceAccounts allowed to stream events, as "<namespace>:<name>"
+	ServiceAccounts []string
+}
+
+var _ runner.Runner = (*Server)(nil)
+
+// Server receives the events pushed by the agents. Only the leader has a sink, the others
+// reject the streams so that agents retry until they reach the leader.
+type Server struct {
+	client          kubernetes.Interface
+	opts            ServerOptions
+	serviceAccounts sets.Set[string]
+
+	mu   sync.RWMutex
+	sink *events.Queue[events.CollectorEvent]
+	// seen acknowledges retransmitted events without handling them again
+	seen *ttlcache.Cache[string, struct{}]
+}
+
+// NewServer creates the server, the agents are authenticated by their service account tokens.
+func NewServer(cli kubernetes.Interface, opts ServerOptions) *Server {
+	if len(opts.ServiceAccounts) == 0 {
+		klog.Warning("no service account is allowed to stream events, all the streams will be rejected")
+	}
+	return &Server{
+		client:          cli,
+		opts:            opts,
+		serviceAccounts: sets.New(opts.ServiceAccounts...),
+		seen: ttlcache.New[string, struct{}](
+			ttlcache.WithTTL[string, struct{}](2*opts.MaxEventAge),
+			ttlcache.WithDisableTouchOnHit[string, struct{}](),
+		),
+	}
+}
+
+// Start starts evicting the expired retransmission records.
+func (s *Server) Start() error {
+	go s.seen.Start()
+	return nil
+}
+
+func (s *Server) Stop() {
+	s.seen.Stop()
+}
+
+// SetSink sets the queue receiving the events, nil stops accepting events.
+func (s *Server) SetSink(sink *events.Queue[events.CollectorEvent]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sink = sink
+}
+
+func (s *Server) getSink() *events.Queue[events.CollectorEvent] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sink
+}
+
+func (s *Server) accept(ctx context.Context, c *caller, env Envelope) Ack {
+	key := env.Node + "/" + env.Entry.ID
+	if env.Node == c.node && s.seen.Get(key) != nil {
+		streamedEvents.WithLabelValues("duplicated").Inc()
+		return Ack{ID: env.Entry.ID, OK: true}
+	}
+	if err := s.authorize(ctx, c, env); err != nil {
+		klog.Warningf("reject event %s of service account %s: %v", env.Entry.ID, c.serviceAccount, err)
+		streamedEvents.WithLabelValues("forbidden").Inc()
+		return Ack{ID: env.Entry.ID, Error: err.Error()}
+	}
+	if env.Entry.Time.Add(s.opts.MaxEventAge).Before(time.Now()) {
+		klog.Infof("event %s from node %s is too old %s, ignore it", env.Entry.ID, env.Node, env.Entry.Time)
+		streamedEvents.WithLabelValues("stale").Inc()
+		return Ack{ID: env.Entry.ID, OK: true}
+	}
+	sink := s.getSink()
+	if sink == nil {
+		streamedEvents.WithLabelValues("rejected").Inc()
+		return Ack{ID: env.Entry.ID, Error: "not leader"}
+	}
+	if !sink.Push(env.Entry.Event) {
+		streamedEvents.WithLabelValues("dropped").Inc()
+		return Ack{ID: env.Entry.ID, Error: "queue is full"}
+	}
+	s.seen.Set(key, struct{}{}, ttlcache.DefaultTTL)
+	streamedEvents.WithLabelValues("accepted").Inc()
+	return Ack{ID: env.Entry.ID, OK: true}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.getSink() == nil {
+		http.Error(w, "not leader", http.StatusServiceUnavailable)
+		return
+	}
+	c, err := s.authenticate(r.Context(), r)
+	if err != nil {
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			klog.Warningf("reject events stream from %s: %v", r.RemoteAddr, err)
+			http.Error(w, authErr.msg, authErr.status)
+			return
+		}
+		klog.Errorf("authenticate events stream from %s error: %v", r.RemoteAddr, err)
+		http.Error(w, "authentication error", http.StatusInternalServerError)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// acks are written while the agent is still sending events
+	if err := rc.EnableFullDuplex(); err != nil {
+		klog.V(4).Infof("enable full duplex error: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		klog.Errorf("flush stream response error: %v", err)
+		return
+	}
+
+	dec := json.NewDecoder(r.Body)
+	enc := json.NewEncoder(w)
+	for {
+		var env Envelope
+		if err := dec.Decode(&env); err != nil {
+			if !errors.Is(err, io.EOF) {
+				klog.Warningf("read events stream from %s error: %v", r.RemoteAddr, err)
+			}
+			return
+		}
+		ack := s.accept(r.Context(), c, env)
+		if err := enc.Encode(ack); err != nil {
+			klog.Warningf("write ack to %s error: %v", r.RemoteAddr, err)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if !ack.OK && s.getSink() == nil {
+			// lost the leadership, let the agent reconnect
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/events"
+	"k8s.io/klog/v2"
+)
+
+// SpoolEntry is an event waiting to be acknowledged by the controller.
+type SpoolEntry struct {
+	ID    string                `json:"id"`
+	Time  time.Time             `json:"time"`
+	Event events.CollectorEvent `json:"event"`
+}
+
+// Spool buffers the events on disk, so they survive agent restarts while the controller is unreachable.
+type Spool struct {
+	dir        string
+	maxEntries int
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewSpool(dir string, maxEntries int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir %s error: %w", dir, err)
+	}
+	return &Spool{
+		dir:        dir,
+		maxEntries: maxEntries,
+	}, nil
+}
+
+func (s *Spool) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *Spool) Put(e events.CollectorEvent) (SpoolEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.seq++
+	// ids sort in the order the events were put
+	entry := SpoolEntry{
+		ID:    fmt.Sprintf("%020d-%06d", now.UnixNano(), s.seq%1000000),
+		Time:  now,
+		Event: e,
+	}
+	bs, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	tmp := s.path(entry.ID) + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o644); err != nil {
+		return entry, err
+	}
+	if err := os.Rename(tmp, s.path(entry.ID)); err != nil {
+		return entry, err
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return entry, err
+	}
+	for len(ids) > s.maxEntries {
+		klog.Warningf("spool %s is full, drop the oldest event %s", s.dir, ids[0])
+		_ = os.Remove(s.path(ids[0]))
+		ids = ids[1:]
+	}
+	return entry, nil
+}
+
+func (s *Spool) ids() ([]string, error) {
+	des, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(des))
+	for _, de := range des {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(de.Name(), ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// List returns the spooled entries from the oldest to the newest.
+func (s *Spool) List() ([]SpoolEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]SpoolEntry, 0, len(ids))
+	for _, id := range ids {
+		bs, err := os.ReadFile(s.path(id))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				klog.Errorf("read spooled event %s error: %v", id, err)
+			}
+			continue
+		}
+		var entry SpoolEntry
+		if err := json.Unmarshal(bs, &entry); err != nil {
+			klog.Errorf("spooled event %s is corrupted, remove it: %v", id, err)
+			_ = os.Remove(s.path(id))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Spool) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		klog.Errorf("remove spooled event %s error: %v", id, err)
+	}
+}
@@ -0,0 +1,310 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baizeai/kcover/pkg/constants"
+	"github.com/baizeai/kcover/pkg/kube"
+	"github.com/baizeai/kcover/pkg/metrics"
+	"github.com/baizeai/kcover/pkg/runner"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+var _ runner.Runner = (*Controller)(nil)
+
+const (
+	// ActionUncordonNode is the action annotation of the events of the nodes uncordoned after a validation
+	ActionUncordonNode = "uncordon-node"
+
+	ResultPassed = "passed"
+	ResultFailed = "failed"
+
+	probeKind = "validation"
+	// pollInterval of checking the marked nodes and their validations
+	pollInterval = 10 * time.Second
+)
+
+var validations = metrics.NewCounterVec("kcover_node_validations_total",
+	"Number of finished validations of repaired nodes by result.", "result")
+
+type Options struct {
+	// Namespace of the validation pods
+	Namespace string
+	// Template of the validation pods, e.g. dcgmi diag -r 3 followed by a burn-in. The pods are
+	// bound to the validated nodes and tolerate the taints of the cordon, the node passes if the
+	// pod succeeds.
+	Template corev1.PodTemplateSpec
+	// Timeout of a validation from its creation, including pulling the image
+	Timeout time.Duration
+}
+
+// Controller validates the nodes cordoned by kcover once they are marked repaired, and uncordons
+// the nodes which pass. The outcome is recorded in the annotations and events of the node, the
+// state is in the nodes and the validation pods, so a new leader continues the validations.
+type Controller struct {
+	client      kubernetes.Interface
+	opts        Options
+	nodeFactory informers.SharedInformerFactory
+	podFactory  informers.SharedInformerFactory
+	nodes       corelisters.NodeLister
+	pods        corelisters.PodLister
+	recorder    record.EventRecorder
+	stop        chan struct{}
+}
+
+func NewValidationController(cli kubernetes.Interface, opts Options, resync time.Duration) (*Controller, error) {
+	if len(opts.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("the validation pod template has no containers")
+	}
+	if opts.Timeout <= 0 {
+		return nil, fmt.Errorf("validation timeout must be positive")
+	}
+	nodeFactory := informers.NewSharedInformerFactory(cli, resync)
+	podFactory := informers.NewSharedInformerFactoryWithOptions(cli, resync,
+		informers.WithNamespace(opts.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = labels.Set{constants.ProbeLabel: probeKind}.String()
+		}))
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: cli.CoreV1().Events(""),
+	})
+	return &Controller{
+		client:      cli,
+		opts:        opts,
+		nodeFactory: nodeFactory,
+		podFactory:  podFactory,
+		nodes:       nodeFactory.Core().V1().Nodes().Lister(),
+		pods:        podFactory.Core().V1().Pods().Lister(),
+		recorder:    eventBroadcaster.NewRecorder(runtime.NewScheme(), corev1.EventSource{Component: "kcover"}),
+		stop:        make(chan struct{}),
+	}, nil
+}
+
+func (c *Controller) Start() error {
+	c.nodeFactory.Start(c.stop)
+	c.podFactory.Start(c.stop)
+	go func() {
+		for _, f := range []informers.SharedInformerFactory{c.nodeFactory, c.podFactory} {
+			for typ, synced := range f.WaitForCacheSync(c.stop) {
+				if !synced {
+					klog.Errorf("sync %v of the node validation failed", typ)
+					return
+				}
+			}
+		}
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				c.poll(time.Now())
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *Controller) Stop() {
+	close(c.stop)
+}
+
+func (c *Controller) poll(now time.Time) {
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list nodes error: %v", err)
+		return
+	}
+	marked := sets.New[string]()
+	for _, node := range nodes {
+		if _, ok := node.Annotations[constants.RepairedAnnotation]; !ok {
+			continue
+		}
+		marked.Insert(node.Name)
+		if err := c.syncNode(node, now); err != nil {
+			klog.Errorf("validate node %s error: %v", node.Name, err)
+		}
+	}
+	// the validations of the nodes which are no longer marked, e.g. uncordoned by hand
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list validation pods error: %v", err)
+		return
+	}
+	for _, pod := range pods {
+		if !marked.Has(pod.Spec.NodeName) && pod.DeletionTimestamp == nil {
+			klog.Infof("node %s is no longer marked repaired, delete validation %s", pod.Spec.NodeName, pod.Name)
+			c.deletePod(pod.Name)
+		}
+	}
+}
+
+// podName of the validation of the node, one validation runs on a node at a time.
+func podName(node string) string {
+	return "kcover-validation-" + node
+}
+
+func (c *Controller) syncNode(node *corev1.Node, now time.Time) error {
+	if !kube.CordonedByKcover(node) {
+		klog.Infof("node %s is marked repaired but not cordoned by kcover, nothing to validate", node.Name)
+		return kube.PatchNodeAnnotations(context.Background(), c.client, node.Name, map[string]*string{
+			constants.RepairedAnnotation: nil,
+		})
+	}
+	if kube.Quarantined(node) {
+		klog.Infof("node %s is marked repaired but quarantined, it is validated after the quarantine is cleared", node.Name)
+		c.recorder.Eventf(nodeReference(node), corev1.EventTypeWarning, "ValidationSkipped",
+			"node %s is quarantined, clear the quarantine before marking it repaired", node.Name)
+		return kube.PatchNodeAnnotations(context.Background(), c.client, node.Name, map[string]*string{
+			constants.RepairedAnnotation: nil,
+		})
+	}
+	mark := node.Annotations[constants.RepairedAnnotation]
+	pod, err := c.pods.Pods(c.opts.Namespace).Get(podName(node.Name))
+	switch {
+	case apierrors.IsNotFound(err):
+		return c.createPod(node.Name, mark)
+	case err != nil:
+		return err
+	case pod.DeletionTimestamp != nil:
+		return nil
+	case pod.Annotations[constants.RepairedAnnotation] != mark:
+		// the node was marked again, the pod validated an earlier repair
+		c.deletePod(pod.Name)
+		return nil
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return c.pass(node, pod, now)
+	case corev1.PodFailed:
+		return c.fail(node, pod, failureMessage(pod), now)
+	default:
+		if now.Sub(pod.CreationTimestamp.Time) > c.opts.Timeout+pollInterval {
+			return c.fail(node, pod, fmt.Sprintf("still %s after %v", pod.Status.Phase, c.opts.Timeout), now)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) createPod(node, mark string) error {
+	tmpl := c.opts.Template.DeepCopy()
+	pod := &corev1.Pod{
+		ObjectMeta: tmpl.ObjectMeta,
+		Spec:       tmpl.Spec,
+	}
+	pod.Name = podName(node)
+	pod.GenerateName = ""
+	pod.Namespace = c.opts.Namespace
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[constants.ProbeLabel] = probeKind
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[constants.RepairedAnnotation] = mark
+	pod.Spec.NodeName = node
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	deadline := int64(c.opts.Timeout.Seconds())
+	pod.Spec.ActiveDeadlineSeconds = &deadline
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations,
+		corev1.Toleration{Key: constants.UnhealthyTaintKey, Operator: corev1.TolerationOpExists},
+		corev1.Toleration{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists},
+	)
+	_, err := c.client.CoreV1().Pods(c.opts.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// the cache has not seen it yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	klog.Infof("validation %s started on node %s", pod.Name, node)
+	return nil
+}
+
+// failureMessage describes the first failed container of the pod, or the pod status.
+func failureMessage(pod *corev1.Pod) string {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, cs := range statuses {
+			if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+				return strings.TrimSpace(fmt.Sprintf("container %s exited with %d: %s %s", cs.Name, t.ExitCode, t.Reason, t.Message))
+			}
+		}
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", pod.Status.Reason, pod.Status.Message))
+}
+
+func nodeReference(node *corev1.Node) *corev1.ObjectReference {
+	return &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: node.Name, UID: node.UID}
+}
+
+// pass uncordons the node like kcoverctl uncordon, the mark is removed last so a failed step is
+// retried by the next poll.
+func (c *Controller) pass(node *corev1.Node, pod *corev1.Pod, now time.Time) error {
+	ctx := context.Background()
+	if err := kube.RemoveNodeTaint(ctx, c.client, node.Name, constants.UnhealthyTaintKey); err != nil {
+		return fmt.Errorf("remove taint error: %w", err)
+	}
+	if err := kube.SetNodeUnschedulable(ctx, c.client, node.Name, false); err != nil {
+		return fmt.Errorf("uncordon error: %w", err)
+	}
+	at, result := now.Format(time.RFC3339), ResultPassed
+	if err := kube.PatchNodeAnnotations(ctx, c.client, node.Name, map[string]*string{
+		constants.CordonedAtAnnotation:       nil,
+		constants.CordonReasonAnnotation:     nil,
+		constants.RepairedAnnotation:         nil,
+		constants.ValidatedAtAnnotation:      &at,
+		constants.ValidationResultAnnotation: &result,
+	}); err != nil {
+		return fmt.Errorf("record the validation error: %w", err)
+	}
+	validations.WithLabelValues(ResultPassed).Inc()
+	c.recorder.AnnotatedEventf(nodeReference(node), map[string]string{constants.ActionAnnotation: ActionUncordonNode},
+		corev1.EventTypeNormal, "ValidationPassed", "validation %s passed, uncordoned node %s", pod.Name, node.Name)
+	klog.Infof("validation %s passed, node %s has been uncordoned", pod.Name, node.Name)
+	c.deletePod(pod.Name)
+	return nil
+}
+
+// fail keeps the node cordoned, it is validated again when it is marked repaired again.
+func (c *Controller) fail(node *corev1.Node, pod *corev1.Pod, message string, now time.Time) error {
+	at, result := now.Format(time.RFC3339), ResultFailed+": "+message
+	if err := kube.PatchNodeAnnotations(context.Background(), c.client, node.Name, map[string]*string{
+		constants.RepairedAnnotation:         nil,
+		constants.ValidatedAtAnnotation:      &at,
+		constants.ValidationResultAnnotation: &result,
+	}); err != nil {
+		return fmt.Errorf("record the validation error: %w", err)
+	}
+	validations.WithLabelValues(ResultFailed).Inc()
+	c.recorder.Eventf(nodeReference(node), corev1.EventTypeWarning, "ValidationFailed",
+		"validation %s failed, node %s stays cordoned: %s", pod.Name, node.Name, message)
+	klog.Warningf("validation %s failed, node %s stays cordoned: %s", pod.Name, node.Name, message)
+	c.deletePod(pod.Name)
+	return nil
+}
+
+func (c *Controller) deletePod(name string) {
+	err := c.client.CoreV1().Pods(c.opts.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("delete validation %s error: %v", name, err)
+	}
+}